@@ -0,0 +1,204 @@
+package azuread
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"azure-openai-proxy/config"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAuthority = "https://login.microsoftonline.com"
+	defaultScope     = "https://cognitiveservices.azure.com/.default"
+
+	// refreshBefore 在过期前多久刷新 token
+	refreshBefore = 5 * time.Minute
+	// minRefreshInterval 两次成功刷新之间的最小间隔，防止 expires_in 过短时频繁请求
+	minRefreshInterval = 30 * time.Second
+	// maxRetryInterval 刷新失败后重试间隔的上限（从 5s 开始指数增长）
+	maxRetryInterval = time.Minute
+	// FailureThreshold 连续刷新失败达到该次数时视为凭据不可用
+	FailureThreshold = 3
+
+	requestTimeout = 10 * time.Second
+)
+
+// TokenSource 通过 client credentials 流程获取 Azure AD access token，并在后台提前刷新
+// 请求路径只读取缓存的 token，不会同步等待刷新
+type TokenSource struct {
+	cfg    config.AzureADConfig
+	client *http.Client
+	logger *zap.Logger
+
+	token     string
+	expiresAt time.Time
+	failures  int
+	lastErr   error
+	ready     chan struct{} // 首次获取结束（无论成功与否）后关闭
+	mu        sync.RWMutex
+}
+
+// NewTokenSource 创建 TokenSource 并启动后台刷新
+func NewTokenSource(cfg config.AzureADConfig, logger *zap.Logger) *TokenSource {
+	s := &TokenSource{
+		cfg:    cfg,
+		client: &http.Client{Timeout: requestTimeout},
+		logger: logger.With(
+			zap.String("tenant_id", cfg.TenantID),
+			zap.String("client_id", cfg.ClientID),
+		),
+		ready: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Key 返回凭据的唯一标识，相同凭据的后端共享同一个 TokenSource
+func Key(cfg config.AzureADConfig) string {
+	return strings.Join([]string{cfg.Authority, cfg.TenantID, cfg.ClientID, cfg.ClientSecret, cfg.Scope}, "|")
+}
+
+// Token 返回当前有效的 token
+// 仅在首次获取完成前等待；此后 token 已过期且刷新失败时直接返回错误
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.token != "" && time.Now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+	if s.lastErr != nil {
+		return "", fmt.Errorf("azure ad token unavailable: %w", s.lastErr)
+	}
+	return "", errors.New("azure ad token expired")
+}
+
+// Failing 连续刷新失败次数是否已达到阈值
+func (s *TokenSource) Failing() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.failures >= FailureThreshold
+}
+
+func (s *TokenSource) run() {
+	first := true
+	for {
+		token, expiresIn, err := s.fetch()
+
+		s.mu.Lock()
+		var wait time.Duration
+		if err != nil {
+			s.failures++
+			s.lastErr = err
+			wait = retryInterval(s.failures)
+		} else {
+			s.token = token
+			s.expiresAt = time.Now().Add(expiresIn)
+			s.failures = 0
+			s.lastErr = nil
+			wait = max(expiresIn-refreshBefore, minRefreshInterval)
+		}
+		failures := s.failures
+		s.mu.Unlock()
+
+		switch {
+		case err == nil:
+			s.logger.Info("azure ad token refreshed", zap.Duration("expires_in", expiresIn))
+		case failures >= FailureThreshold:
+			s.logger.Error("azure ad token refresh failing repeatedly, backends using this credential will be marked unhealthy",
+				zap.Int("consecutive_failures", failures),
+				zap.Duration("retry_in", wait),
+				zap.Error(err),
+			)
+		default:
+			s.logger.Warn("azure ad token refresh failed",
+				zap.Int("consecutive_failures", failures),
+				zap.Duration("retry_in", wait),
+				zap.Error(err),
+			)
+		}
+
+		if first {
+			close(s.ready)
+			first = false
+		}
+		time.Sleep(wait)
+	}
+}
+
+// retryInterval 第 n 次连续失败后的重试间隔
+func retryInterval(failures int) time.Duration {
+	interval := 5 * time.Second
+	for i := 1; i < failures && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, maxRetryInterval)
+}
+
+// fetch 请求 token 端点
+func (s *TokenSource) fetch() (string, time.Duration, error) {
+	authority := s.cfg.Authority
+	if authority == "" {
+		authority = defaultAuthority
+	}
+	scope := s.cfg.Scope
+	if scope == "" {
+		scope = defaultScope
+	}
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(authority, "/"), url.PathEscape(s.cfg.TenantID))
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.cfg.ClientID},
+		"client_secret": {s.cfg.ClientSecret},
+		"scope":         {scope},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, err
+	}
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", 0, fmt.Errorf("token endpoint returned status %d: invalid response: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", 0, fmt.Errorf("token endpoint returned status %d: %s: %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	return result.AccessToken, time.Duration(result.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/handlers"
+	"azure-openai-proxy/loadbalancer"
+
+	"go.uber.org/zap"
+)
+
+// runCheck 校验配置而不启动服务（--check），用于部署前检查；probe 为 true 时对每个后端做一次主动探测
+// 报告写入 out，返回进程退出码：配置无效或任一后端探测失败时为 1
+func runCheck(configPath string, probe bool, out io.Writer) int {
+	// Read 会完整执行 Validate
+	cfg, err := config.Read(configPath)
+	if err != nil {
+		fmt.Fprintf(out, "配置无效: %v\n", err)
+		return 1
+	}
+
+	names := make([]string, 0, len(cfg.Models))
+	backends := 0
+	for name, modelCfg := range cfg.Models {
+		names = append(names, name)
+		backends += len(modelCfg.Backends)
+	}
+	sort.Strings(names)
+
+	// 创建处理器会校验转换规则、镜像与后端 TLS 配置，这些错误在 Validate 中不会暴露
+	// 只做一次探测，不重试；探测结果由报告输出，不需要处理器自身的日志
+	checkCfg := *cfg
+	checkCfg.HealthCheck.ProbeAttempts = 1
+	handler, err := handlers.NewProxyHandler(loadbalancer.GetInstance(), &checkCfg, zap.NewNop())
+	if err != nil {
+		fmt.Fprintf(out, "配置无效: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "配置有效: %s（%d 个模型，%d 个后端）\n", configPath, len(names), backends)
+	if !probe {
+		return 0
+	}
+
+	failed := 0
+	check := func(label string, modelCfg *config.ModelConfig) {
+		for _, backend := range modelCfg.Backends {
+			endpoint := loadbalancer.MaskEndpoint(backend.Endpoint)
+			latency, err := handler.Probe(backend)
+			if err != nil {
+				failed++
+				fmt.Fprintf(out, "  [失败] %s %s (%s): %v\n", label, endpoint, backend.Deployment, err)
+				continue
+			}
+			fmt.Fprintf(out, "  [正常] %s %s (%s) %s\n", label, endpoint, backend.Deployment, latency.Round(time.Millisecond))
+		}
+	}
+	fmt.Fprintln(out, "探测后端:")
+	for _, name := range names {
+		modelCfg := cfg.Models[name]
+		check(name, &modelCfg)
+	}
+	if cfg.CatchAll != nil {
+		check("catch_all", cfg.CatchAll)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(out, "%d 个后端探测失败\n", failed)
+		return 1
+	}
+	fmt.Fprintln(out, "所有后端探测成功")
+	return 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCheckConfig(t *testing.T, endpoint, healthCheck string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := healthCheck + `
+models:
+  gpt-4:
+    backends:
+      - endpoint: "` + endpoint + `"
+        api_key: test
+        deployment: gpt-4
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunCheckProbe(t *testing.T) {
+	var probes int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name        string
+		endpoint    string
+		healthCheck string
+		wantCode    int
+		wantProbes  int
+		wantOutput  string
+	}{
+		{"healthy backend", upstream.URL, "", 0, 1, "所有后端探测成功"},
+		// probe_attempts 为 0 时不能在未探测的情况下报告成功
+		{"probe_attempts 0 rejected", upstream.URL, "health_check:\n  probe_attempts: 0\n", 1, 0, "probe_attempts"},
+		{"unreachable backend", "http://127.0.0.1:1", "", 1, 0, "1 个后端探测失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes = 0
+			var out bytes.Buffer
+			code := runCheck(writeCheckConfig(t, tt.endpoint, tt.healthCheck), true, &out)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d\n%s", code, tt.wantCode, out.String())
+			}
+			if probes != tt.wantProbes {
+				t.Errorf("backend probed %d times, want %d", probes, tt.wantProbes)
+			}
+			if !strings.Contains(out.String(), tt.wantOutput) {
+				t.Errorf("output does not contain %q:\n%s", tt.wantOutput, out.String())
+			}
+		})
+	}
+}
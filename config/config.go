@@ -1,10 +1,21 @@
 package config
 
 import (
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Backend struct {
@@ -12,64 +23,1035 @@ type Backend struct {
 	APIKey     string `mapstructure:"api_key"`
 	Deployment string `mapstructure:"deployment"`
 	APIVersion string `mapstructure:"api_version"`
+	MaxRPM     int    `mapstructure:"max_rpm"` // 每分钟最大请求数，0 表示不限制
+	MaxTPM     int    `mapstructure:"max_tpm"` // 每分钟最大 token 数，0 表示不限制
+	// MaxConcurrent 同时进行中的最大请求数（包括长时间的流式请求），0 表示不限制
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+	// AzureAD 配置后使用 Azure AD（client credentials）token 认证，代替 api_key
+	AzureAD *AzureADConfig `mapstructure:"azure_ad"`
+	// Tags 后端标签（如区域），开启 model_tags 后可通过 model@tag 指定后端
+	Tags []string `mapstructure:"tags"`
+	// APIVersions api-version 回退链：api_version 返回版本相关的 400 时依次用这些版本重试同一后端
+	APIVersions []string `mapstructure:"api_versions"`
+	// GzipRequests 以 gzip 压缩转发请求体（需后端支持 Content-Encoding: gzip）
+	GzipRequests bool `mapstructure:"gzip_requests"`
+	// DisableCompression 不请求压缩的响应（Accept-Encoding: identity），默认由传输层请求 gzip 并自动解压
+	DisableCompression bool `mapstructure:"disable_compression"`
+	// Type 后端类型：azure（默认）或 openai（OpenAI 官方 API 及兼容服务）
+	// openai 后端的 endpoint 形如 https://api.openai.com/v1，使用 Bearer 认证，deployment 作为请求体中的模型名称
+	Type string `mapstructure:"type"`
+	// TLS 该后端独立的 TLS 配置（私有 CA、mTLS 客户端证书等），未配置时使用系统默认
+	TLS *BackendTLSConfig `mapstructure:"tls"`
+	// Weight weighted 策略下的权重，0 视为 1
+	Weight int `mapstructure:"weight"`
+	// Tiers 配置后该后端只服务这些层级（auth.keys[].tier）的 key，未配置时服务所有 key
+	Tiers []string `mapstructure:"tiers"`
+	// Locality 后端所在的区域，locality 策略优先选择与 loadbalancer.locality 相同的后端
+	Locality string `mapstructure:"locality"`
+}
+
+const (
+	BackendTypeAzure  = "azure"
+	BackendTypeOpenAI = "openai"
+)
+
+// IsOpenAI 检查是否为 OpenAI（非 Azure）后端
+func (b Backend) IsOpenAI() bool {
+	return b.Type == BackendTypeOpenAI
+}
+
+// HasTag 检查后端是否带有指定标签（忽略大小写）
+func (b Backend) HasTag(tag string) bool {
+	for _, t := range b.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServesTier 检查后端是否服务该层级的 key：未配置 tiers 的后端服务所有 key，否则只服务列出的层级
+func (b Backend) ServesTier(tier string) bool {
+	if len(b.Tiers) == 0 {
+		return true
+	}
+	for _, t := range b.Tiers {
+		if strings.EqualFold(t, tier) {
+			return true
+		}
+	}
+	return false
+}
+
+// AzureADConfig Azure AD 服务主体凭据
+type AzureADConfig struct {
+	TenantID     string `mapstructure:"tenant_id"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	Authority    string `mapstructure:"authority"` // 默认 https://login.microsoftonline.com
+	Scope        string `mapstructure:"scope"`     // 默认 https://cognitiveservices.azure.com/.default
 }
 
 type ModelConfig struct {
-	Backends []Backend `mapstructure:"backends"`
+	Backends      []Backend `mapstructure:"backends"`
+	DisableStream bool      `mapstructure:"disable_stream"` // 拒绝 stream: true 的请求
+	Strategy      string    `mapstructure:"strategy"`       // 该模型的负载均衡策略，为空时使用 loadbalancer.strategy
+	// Enabled 为 false 时拒绝该模型的所有请求（返回 503），未配置时视为启用
+	Enabled *bool `mapstructure:"enabled"`
+	// MaxStreamDuration、MaxStreamBytes 限制单个流式响应的时长与转发字节数，超出后截断并发送错误事件，0 表示不限制
+	MaxStreamDuration time.Duration `mapstructure:"max_stream_duration"`
+	MaxStreamBytes    int64         `mapstructure:"max_stream_bytes"`
+	// URLTemplates API 类型 -> Azure 后端的 URL 模板，支持 {endpoint}、{deployment}、{api_version} 占位符，
+	// 未配置的 API 类型使用默认的 /openai/deployments/{deployment}/{api_type} 路径
+	URLTemplates map[string]string `mapstructure:"url_templates"`
+}
+
+// urlTemplateAPITypes 可以配置 url_templates 的 API 类型
+var urlTemplateAPITypes = map[string]bool{
+	"chat/completions": true,
+	"completions":      true,
+	"embeddings":       true,
+	"responses":        true,
+	"audio/speech":     true,
+}
+
+// IsEnabled 检查模型是否启用
+func (m ModelConfig) IsEnabled() bool {
+	return m.Enabled == nil || *m.Enabled
+}
+
+// PinnedBackends 返回 pin 指定的后端：pin 为整数时取 backends 中该下标（从 0 开始）的后端，
+// 否则取 endpoint 相同（忽略末尾的 /）的后端
+func (m ModelConfig) PinnedBackends(pin string) []Backend {
+	if index, err := strconv.Atoi(pin); err == nil {
+		if index < 0 || index >= len(m.Backends) {
+			return nil
+		}
+		return []Backend{m.Backends[index]}
+	}
+	var result []Backend
+	for _, backend := range m.Backends {
+		if strings.TrimSuffix(backend.Endpoint, "/") == strings.TrimSuffix(pin, "/") {
+			result = append(result, backend)
+		}
+	}
+	return result
+}
+
+// 负载均衡策略
+const (
+	StrategyRoundRobin   = "round_robin"
+	StrategyWeighted     = "weighted"
+	StrategyLeastConn    = "least_conn"
+	StrategyRandom       = "random"
+	StrategyHash         = "hash"
+	StrategyLatencyAware = "latency_aware"
+	StrategyLocality     = "locality"
+)
+
+// validStrategy 检查策略名称是否有效
+func validStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyRoundRobin, StrategyWeighted, StrategyLeastConn, StrategyRandom, StrategyHash, StrategyLatencyAware, StrategyLocality:
+		return true
+	}
+	return false
 }
 
 type ServerConfig struct {
 	Port int `mapstructure:"port"`
+	// UpstreamHeaders 在响应中附加 X-Upstream-* 与 X-Azure-Api-Version 头，标识实际处理请求的后端（用于排查问题）
+	UpstreamHeaders bool `mapstructure:"upstream_headers"`
+	// TrustedProxies 可信代理的 IP 或 CIDR，只有来自这些地址的 X-Forwarded-For/X-Real-IP 才会用于解析客户端 IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// ReadTimeout 读取请求体的时间上限，超出时返回 408，防止慢速上传长期占用连接；0 表示不限制
+	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+	// MaxInFlight /v1 接口同时处理的请求数上限，超出时返回 503，0 表示不限制
+	MaxInFlight int `mapstructure:"max_in_flight"`
+	// WebSocket 启用 /v1/chat/completions/ws，通过 WebSocket 返回流式响应
+	WebSocket bool `mapstructure:"websocket"`
+	// StreamErrorEvent 上游流式响应中途出错时向客户端发送一个 SSE 错误事件，而不是直接截断
+	StreamErrorEvent bool `mapstructure:"stream_error_event"`
+	// StreamPacing 限制流式响应转发给客户端的速率
+	StreamPacing StreamPacingConfig `mapstructure:"stream_pacing"`
+	// MaxStreamEventSize 流式响应中单个 SSE 事件的最大字节数，0 表示不限制
+	MaxStreamEventSize int `mapstructure:"max_stream_event_size"`
+	// OversizedStreamEvent 单个 SSE 事件超出 MaxStreamEventSize 时的处理方式
+	OversizedStreamEvent string `mapstructure:"oversized_stream_event"`
+	// ResponseCompression 客户端支持 gzip 时压缩较大的非流式响应
+	ResponseCompression ResponseCompressionConfig `mapstructure:"response_compression"`
+}
+
+// 超长 SSE 事件的处理方式
+const (
+	OversizedStreamEventPassthrough = "passthrough" // 原样转发，不解析其中的 usage
+	OversizedStreamEventTruncate    = "truncate"    // 只转发前 max_stream_event_size 字节，丢弃其余部分直到事件结束
+	OversizedStreamEventError       = "error"       // 发送 SSE 错误事件并结束响应
+)
+
+// ResponseCompressionConfig 非流式响应的 gzip 压缩配置
+type ResponseCompressionConfig struct {
+	Enabled   bool `mapstructure:"enabled"`
+	MinSizeKB int  `mapstructure:"min_size_kb"` // 响应体达到该大小才压缩
+}
+
+// StreamPacingConfig 流式响应转发速率限制，均为 0 时不限制
+type StreamPacingConfig struct {
+	BytesPerSecond  int `mapstructure:"bytes_per_second"`
+	EventsPerSecond int `mapstructure:"events_per_second"` // 按 SSE 事件（空行分隔）计数
+}
+
+// HealthCheckConfig 健康检查配置
+type HealthCheckConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // 检查间隔
+	// Probe 为 true 时不健康的后端需主动探测成功才恢复，否则超时后直接恢复
+	Probe         bool          `mapstructure:"probe"`
+	ProbeTimeout  time.Duration `mapstructure:"probe_timeout"`  // 单次探测超时
+	ProbeAttempts int           `mapstructure:"probe_attempts"` // 判定失败前的探测次数
+	ProbeBackoff  time.Duration `mapstructure:"probe_backoff"`  // 首次重试间隔，之后每次翻倍
+	// HealthyThreshold 主动探测时恢复所需的连续成功次数
+	HealthyThreshold int `mapstructure:"healthy_threshold"`
+	// ReadinessGate 为 true 时启动后先主动探测所有后端，完成前 /ready 返回 503
+	ReadinessGate bool `mapstructure:"readiness_gate"`
+	// LatencyProbe 为 true 时每个检查周期也探测健康的后端，记录往返时间作为基线延迟
+	LatencyProbe bool `mapstructure:"latency_probe"`
+}
+
+// TransportConfig 到后端的 HTTP 传输配置
+type TransportConfig struct {
+	// HTTP2 协议选择：auto（通过 ALPN 协商，不支持时回退 HTTP/1.1）、force（仅 HTTP/2）、disabled（仅 HTTP/1.1）
+	HTTP2 string `mapstructure:"http2"`
+	// H2C 对 http:// 后端使用明文 HTTP/2（prior knowledge），需配合 http2: force
+	H2C bool `mapstructure:"h2c"`
+	// DialTimeout 建立 TCP 连接的超时，与请求总超时独立，后端主机不可达时尽快失败并故障转移
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	// TLSHandshakeTimeout TLS 握手的超时
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout"`
 }
 
 type RetryConfig struct {
 	MaxAttempts int           `mapstructure:"max_attempts"`
 	Timeout     time.Duration `mapstructure:"timeout"`
+	// StreamTimeout 流式请求的总时长上限；流式请求的 timeout 只约束等待响应头的时间
+	StreamTimeout time.Duration `mapstructure:"stream_timeout"`
+	// Backoff 首次重试前的等待时间，之后每次翻倍，不超过 MaxBackoff；0 表示立即重试
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// Jitter 退避等待的随机抖动比例（0.0-1.0）：实际等待时间在 [退避×(1-Jitter), 退避] 之间随机，避免大量重试同时发生
+	Jitter float64 `mapstructure:"jitter"`
+	// MaxElapsed 重试总耗时上限，超出后即使还有剩余次数也不再重试；0 表示不限制
+	MaxElapsed time.Duration `mapstructure:"max_elapsed"`
+	// Timeouts 按 API 类型覆盖 timeout
+	Timeouts APITimeouts `mapstructure:"timeouts"`
+	// PerBackendAttempts 每个后端连续尝试的次数，用尽后才切换到下一个后端；MaxAttempts 限制尝试的不同后端数
+	PerBackendAttempts int `mapstructure:"per_backend_attempts"`
+	// ValidateResponse 校验非流式 200 响应是否为包含预期字段的 JSON，否则视为后端故障并切换后端
+	ValidateResponse bool `mapstructure:"validate_response"`
+	// ReturnLastError 所有尝试都失败时原样返回最后一个后端的 5xx 状态码和响应体，而不是统一的 503
+	ReturnLastError bool `mapstructure:"return_last_error"`
+}
+
+// TotalAttempts 返回对 backends 个候选后端的总尝试次数
+func (r RetryConfig) TotalAttempts(backends int) int {
+	return min(r.MaxAttempts, backends) * max(r.PerBackendAttempts, 1)
+}
+
+// BackendIndex 返回第 attempt 次尝试（从 0 开始）使用的后端序号，同一后端的尝试连续进行
+func (r RetryConfig) BackendIndex(attempt int) int {
+	return attempt / max(r.PerBackendAttempts, 1)
+}
+
+// APITimeouts 按 API 类型设置的请求超时，0 表示使用 retry.timeout
+type APITimeouts struct {
+	ChatCompletions time.Duration `mapstructure:"chat_completions"`
+	Embeddings      time.Duration `mapstructure:"embeddings"`
+	Responses       time.Duration `mapstructure:"responses"`
+}
+
+// TimeoutFor 返回该 API 类型的请求超时
+func (r RetryConfig) TimeoutFor(apiType string) time.Duration {
+	var timeout time.Duration
+	switch apiType {
+	case "chat/completions":
+		timeout = r.Timeouts.ChatCompletions
+	case "embeddings":
+		timeout = r.Timeouts.Embeddings
+	case "responses":
+		timeout = r.Timeouts.Responses
+	}
+	if timeout <= 0 {
+		return r.Timeout
+	}
+	return timeout
 }
 
 // APIKeyConfig 单个 API Key 配置
+// key 与 key_hash 二选一；key_hash 支持 "sha256:<hex>" 和 bcrypt（$2a$/$2b$/$2y$ 开头）两种格式
 type APIKeyConfig struct {
-	Name string `mapstructure:"name"`
-	Key  string `mapstructure:"key"`
+	Name    string `mapstructure:"name"`
+	Key     string `mapstructure:"key"`
+	KeyHash string `mapstructure:"key_hash"`
+	Admin   bool   `mapstructure:"admin"` // 允许使用 X-No-Retry 等调试用请求头
+	// SkipContentSafety 为 true 时跳过 content_safety 检查，用于受信任的内部服务
+	SkipContentSafety bool `mapstructure:"skip_content_safety"`
+	// Tier key 所属的层级（如 free/paid），只使用 tiers 包含该层级或未配置 tiers 的后端
+	Tier string `mapstructure:"tier"`
+	// MaxConcurrent 该 key 同时进行中的请求数上限，超出时返回 429；0 表示不限制
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+	// Pins 模型 -> 固定使用的后端（backends 下标或 endpoint），该 key 的请求只发往该后端，用于金丝雀验证
+	Pins map[string]string `mapstructure:"pins"`
+}
+
+const sha256HashPrefix = "sha256:"
+
+// bcryptMatches 缓存 bcrypt 校验成功的结果，避免每个请求都执行一次 bcrypt
+// key 为 key_hash 与客户端 key 的 SHA-256 摘要组合，哈希变更（如重载配置）后自然失效
+var bcryptMatches sync.Map
+
+const (
+	bcryptMissTTL        = time.Minute
+	bcryptMissMaxEntries = 10000
+)
+
+// bcryptMisses 短时缓存 bcrypt 校验失败的结果，重复提交的错误 key 不再计算 bcrypt
+var bcryptMisses = &missCache{entries: make(map[string]time.Time)}
+
+// bcryptSlots 限制同时进行的 bcrypt 计算数，大量不同的错误 key 最多占用一半 CPU，不会拖垮转发
+var bcryptSlots = make(chan struct{}, max(1, runtime.GOMAXPROCS(0)/2))
+
+// missCache 带过期时间的有界集合，写满时先清理过期条目，仍然写满则整体清空
+type missCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func (m *missCache) contains(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expires, ok := m.entries[key]
+	if ok && time.Now().After(expires) {
+		delete(m.entries, key)
+		return false
+	}
+	return ok
+}
+
+func (m *missCache) add(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if len(m.entries) >= bcryptMissMaxEntries {
+		for k, expires := range m.entries {
+			if now.After(expires) {
+				delete(m.entries, k)
+			}
+		}
+		if len(m.entries) >= bcryptMissMaxEntries {
+			clear(m.entries)
+		}
+	}
+	m.entries[key] = now.Add(bcryptMissTTL)
+}
+
+// matches 检查客户端 key 是否与该配置匹配，明文与 sha256 均使用常量时间比较
+func (k APIKeyConfig) matches(key string) bool {
+	if k.KeyHash == "" {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(k.Key)) == 1
+	}
+
+	digest := sha256.Sum256([]byte(key))
+	if hexHash, ok := strings.CutPrefix(k.KeyHash, sha256HashPrefix); ok {
+		expected, err := hex.DecodeString(hexHash)
+		if err != nil {
+			return false
+		}
+		return subtle.ConstantTimeCompare(digest[:], expected) == 1
+	}
+
+	// 空 key 与超过 72 字节的 key 不可能匹配 bcrypt 哈希，直接拒绝
+	if key == "" || len(key) > 72 {
+		return false
+	}
+	cacheKey := k.KeyHash + "\x00" + string(digest[:])
+	if _, ok := bcryptMatches.Load(cacheKey); ok {
+		return true
+	}
+	if bcryptMisses.contains(cacheKey) {
+		return false
+	}
+	bcryptSlots <- struct{}{}
+	err := bcrypt.CompareHashAndPassword([]byte(k.KeyHash), []byte(key))
+	<-bcryptSlots
+	if err != nil {
+		bcryptMisses.add(cacheKey)
+		return false
+	}
+	bcryptMatches.Store(cacheKey, struct{}{})
+	return true
+}
+
+// validateKeyHash 校验 key_hash 格式
+func validateKeyHash(hash string) error {
+	if hexHash, ok := strings.CutPrefix(hash, sha256HashPrefix); ok {
+		if decoded, err := hex.DecodeString(hexHash); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("invalid sha256 hash")
+		}
+		return nil
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("must be sha256:<hex> or a bcrypt hash: %w", err)
+	}
+	return nil
 }
 
 // AuthConfig 认证配置
 type AuthConfig struct {
 	Enabled bool           `mapstructure:"enabled"`
 	Keys    []APIKeyConfig `mapstructure:"keys"`
+	// ExemptPaths 免认证的路径，以 * 结尾时按前缀匹配，否则精确匹配
+	ExemptPaths []string `mapstructure:"exempt_paths"`
+}
+
+// IsExemptPath 检查请求路径是否免认证
+func (a AuthConfig) IsExemptPath(path string) bool {
+	for _, exempt := range a.ExemptPaths {
+		if prefix, ok := strings.CutSuffix(exempt, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == exempt {
+			return true
+		}
+	}
+	return false
+}
+
+// IPAllowlistConfig IP 白名单配置
+// Groups 按路由组名称（如 admin）配置允许访问的 CIDR 列表，未配置的组不做限制
+type IPAllowlistConfig struct {
+	TrustedProxyCount int                 `mapstructure:"trusted_proxy_count"`
+	Groups            map[string][]string `mapstructure:"groups"`
+}
+
+// LoggingConfig 日志输出配置
+type LoggingConfig struct {
+	Level             string `mapstructure:"level"`       // debug/info/warn/error
+	Format            string `mapstructure:"format"`      // json 或 console
+	TimeFormat        string `mapstructure:"time_format"` // iso8601/rfc3339/rfc3339nano/epoch/epoch_millis
+	DisableTimestamp  bool   `mapstructure:"disable_timestamp"`
+	DisableCaller     bool   `mapstructure:"disable_caller"`
+	DisableStacktrace bool   `mapstructure:"disable_stacktrace"`
+	// RedactFields 输出请求体（镜像等）时需要脱敏的 JSON 字段名，任意层级匹配
+	RedactFields []string `mapstructure:"redact_fields"`
+	// BodySampleRate 以 info 级别记录请求/响应体的请求比例（0.0-1.0），已脱敏
+	BodySampleRate float64 `mapstructure:"body_sample_rate"`
+	// RequestSampleRate 记录快速成功（2xx）请求日志的比例（0.0-1.0），非 2xx 与慢请求始终记录
+	RequestSampleRate float64 `mapstructure:"request_sample_rate"`
+	// SlowRequestThreshold 超过该耗时的请求视为慢请求，始终记录，0 表示不区分
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+	// AuditPath 管理操作审计日志的输出文件（JSON 行），为空时输出到主日志（logger 名为 audit）
+	AuditPath string `mapstructure:"audit_path"`
+	// KeyMaskPrefix 日志中 API Key 保留的前缀字符数，KeyMaskMinLength 短于该长度的 key 完全遮蔽
+	KeyMaskPrefix    int `mapstructure:"key_mask_prefix"`
+	KeyMaskMinLength int `mapstructure:"key_mask_min_length"`
+	// AccessLogFormat 请求日志格式：json（默认，结构化的 request 日志）或 combined（Combined Log Format 访问日志）
+	AccessLogFormat string `mapstructure:"access_log_format"`
+	// AccessLogPath combined 格式访问日志的输出文件，为空时输出到标准输出
+	AccessLogPath string `mapstructure:"access_log_path"`
+}
+
+// MaskKey 遮蔽日志中的 API Key，只保留前 key_mask_prefix 个字符；
+// 短于 key_mask_min_length 或不长于保留前缀的 key 完全遮蔽
+func (l LoggingConfig) MaskKey(key string) string {
+	if len(key) < l.KeyMaskMinLength || len(key) <= l.KeyMaskPrefix {
+		return "***"
+	}
+	return key[:l.KeyMaskPrefix] + "***"
+}
+
+// MirrorConfig 请求镜像配置：将采样的请求体写入本地文件，便于在测试环境回放
+type MirrorConfig struct {
+	Enabled    bool    `mapstructure:"enabled"`
+	Path       string  `mapstructure:"path"`
+	SampleRate float64 `mapstructure:"sample_rate"` // 0.0-1.0
+	MaxSizeMB  int     `mapstructure:"max_size_mb"` // 单个文件最大大小，超出后滚动
+	MaxBackups int     `mapstructure:"max_backups"` // 保留的历史文件数
+	BufferSize int     `mapstructure:"buffer_size"` // 异步写入缓冲的记录数，满时丢弃
+}
+
+// LoadBalancerConfig 负载均衡配置
+type LoadBalancerConfig struct {
+	// LazyInit 为 true 时模型的 balancer 在第一次请求时才创建，适合模型数量很多的配置
+	LazyInit bool `mapstructure:"lazy_init"`
+	// CaseInsensitiveModels 为 true 时请求中的模型名称忽略大小写匹配配置
+	CaseInsensitiveModels bool `mapstructure:"case_insensitive_models"`
+	// ModelTags 为 true 时支持 model@tag 或 model:tag 形式的模型名称，只选择带有该标签的后端
+	ModelTags bool `mapstructure:"model_tags"`
+	// PassiveHealth 为 false 时请求失败不再将后端标记为不健康，错误直接返回给客户端
+	PassiveHealth bool `mapstructure:"passive_health"`
+	// Strategy 默认的负载均衡策略，模型可通过 strategy 单独覆盖
+	Strategy string `mapstructure:"strategy"`
+	// HashHeader hash 策略使用的请求头，为空或请求未携带时按 API key 名称、再按客户端 IP 计算
+	HashHeader string `mapstructure:"hash_header"`
+	// ExcludeHeader X-Exclude-Endpoint 请求头的生效范围：disabled（默认，忽略）、admin（仅管理员 key）、all（所有请求）
+	ExcludeHeader string `mapstructure:"exclude_header"`
+	// CircuitCooldown 模型的全部后端都不健康后，在该时间内直接返回 503 而不尝试后端；0 表示不启用
+	CircuitCooldown time.Duration `mapstructure:"circuit_cooldown"`
+	// BodyRoutes 按请求体字段选择后端标签的路由规则，按顺序匹配，第一条命中的规则生效
+	BodyRoutes []BodyRoute `mapstructure:"body_routes"`
+	// Locality 本实例所在的区域，locality 策略优先选择 backends[].locality 相同的后端
+	Locality string `mapstructure:"locality"`
+}
+
+// BodyRoute 请求体字段路由规则：字段取值命中 values 时只选择带有对应标签的后端
+type BodyRoute struct {
+	// Field 请求体中的字段路径，以 . 分隔嵌套字段（如 metadata.team）
+	Field string `mapstructure:"field"`
+	// Values 字段取值 -> 后端标签
+	Values map[string]string `mapstructure:"values"`
+}
+
+// WebhookConfig 后端健康状态变化的 webhook 通知配置，URL 为空时不启用
+type WebhookConfig struct {
+	URL         string        `mapstructure:"url"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	MaxRetries  int           `mapstructure:"max_retries"`
+	MinInterval time.Duration `mapstructure:"min_interval"` // 同一后端同类事件的最小通知间隔
+}
+
+// OpenAIHeadersConfig OpenAI-Organization/OpenAI-Project header 的转发映射
+// 值为转发到 Azure 时使用的 header 名，为空时不转发
+type OpenAIHeadersConfig struct {
+	Organization string `mapstructure:"organization"`
+	Project      string `mapstructure:"project"`
+}
+
+// EmbeddingsConfig embeddings 请求配置
+type EmbeddingsConfig struct {
+	// SplitBatchSize input 数组长度超过该值时按该大小拆分，并发转发到多个后端，0 表示不拆分
+	SplitBatchSize int `mapstructure:"split_batch_size"`
+	// MaxConcurrency 单个请求同时转发的分片数上限
+	MaxConcurrency int `mapstructure:"max_concurrency"`
+}
+
+// ImagesConfig 视觉请求中 image_url 的改写配置，需在 transforms 中启用 image_urls
+type ImagesConfig struct {
+	// ProxyPrefix 将远程图片 URL 改写为 proxy_prefix + URL 编码后的原始地址，经内部代理/缓存访问
+	ProxyPrefix string `mapstructure:"proxy_prefix"`
+	// Inline 为 true 时由代理下载图片并转换为 base64 data URL（配置了 proxy_prefix 时经其下载）
+	Inline       bool          `mapstructure:"inline"`
+	MaxSizeMB    int           `mapstructure:"max_size_mb"`   // 内联单张图片的大小上限
+	MaxImages    int           `mapstructure:"max_images"`    // 单个请求内联的图片数量上限
+	FetchTimeout time.Duration `mapstructure:"fetch_timeout"` // 下载单张图片的超时
+	// AllowedHosts 内联时允许下载的图片域名，*.example.com 匹配其子域名；为空时不限制域名（仍拒绝内网地址）
+	AllowedHosts []string `mapstructure:"allowed_hosts"`
+}
+
+// HostAllowed 检查图片地址的域名是否在 allowed_hosts 中，未配置时允许所有域名
+func (c ImagesConfig) HostAllowed(host string) bool {
+	if len(c.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range c.AllowedHosts {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentSafetyConfig 请求内容审核配置，endpoint 与 deny_patterns 都为空时不启用
+type ContentSafetyConfig struct {
+	// Endpoint 内容审核服务地址，代理 POST {"api_type","model","text"}，服务返回 {"flagged":bool,"reason":string}
+	Endpoint string        `mapstructure:"endpoint"`
+	APIKey   string        `mapstructure:"api_key"` // 调用审核服务时作为 Bearer token 发送
+	Timeout  time.Duration `mapstructure:"timeout"`
+	// FailOpen 为 true 时审核服务不可用则放行请求，否则返回 503
+	FailOpen bool `mapstructure:"fail_open"`
+	// DenyPatterns 正则规则，请求中的文本匹配任一规则即拒绝
+	DenyPatterns []string `mapstructure:"deny_patterns"`
+}
+
+// Enabled 是否配置了审核服务或拒绝规则
+func (c ContentSafetyConfig) Enabled() bool {
+	return c.Endpoint != "" || len(c.DenyPatterns) > 0
+}
+
+// CoalescingConfig 相同请求合并配置：模型与请求体相同的进行中非流式请求只转发一次，共享响应
+type CoalescingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ShareAcrossKeys 为 true 时不同 API Key 的相同请求也会合并，此时只有发起转发的 key 记录用量
+	ShareAcrossKeys bool `mapstructure:"share_across_keys"`
+}
+
+// UsageAttributionConfig 用量归属配置：按请求头（如 X-Cost-Center）分组统计 token 用量和成本
+type UsageAttributionConfig struct {
+	Headers []string `mapstructure:"headers"`
+	// DefaultBucket 请求未携带归属头时使用的分组名称
+	DefaultBucket string `mapstructure:"default_bucket"`
+}
+
+// ParamsConfig 请求参数策略
+type ParamsConfig struct {
+	// Strip 转发前静默移除的参数（unsupported_params 转换器使用）
+	Strip []string `mapstructure:"strip"`
+	// Reject 命中后以 400 拒绝请求的规则（reject_params 转换器使用）
+	Reject []ParamRejectRule `mapstructure:"reject"`
+	// Clamp 超出范围时截断到边界的数值参数及其范围（clamp_params 转换器使用），覆盖内置的默认范围
+	Clamp map[string]ParamRange `mapstructure:"clamp"`
+}
+
+// ParamRange 数值参数的取值范围，未配置的一侧不限制
+type ParamRange struct {
+	Min *float64 `mapstructure:"min"`
+	Max *float64 `mapstructure:"max"`
+}
+
+// ParamRejectRule 参数拒绝规则
+// 未配置 min/max 时参数存在即拒绝；配置了 min/max 时数值超出范围才拒绝
+type ParamRejectRule struct {
+	Param   string   `mapstructure:"param"`
+	Min     *float64 `mapstructure:"min"`
+	Max     *float64 `mapstructure:"max"`
+	Message string   `mapstructure:"message"` // 自定义错误信息（可选）
+}
+
+// ModelPricing 模型价格（美元 / 1K tokens），用于估算请求成本
+type ModelPricing struct {
+	Input  float64 `mapstructure:"input"`
+	Output float64 `mapstructure:"output"`
 }
 
 type Config struct {
-	Server ServerConfig           `mapstructure:"server"`
-	Models map[string]ModelConfig `mapstructure:"models"`
-	Retry  RetryConfig            `mapstructure:"retry"`
-	Auth   AuthConfig             `mapstructure:"auth"`
+	Server        ServerConfig            `mapstructure:"server"`
+	Models        map[string]ModelConfig  `mapstructure:"models"`
+	DefaultModel  string                  `mapstructure:"default_model"` // 请求未指定 model 时使用的模型，为空时拒绝
+	CatchAll      *ModelConfig            `mapstructure:"catch_all"`     // 未配置模型的兜底后端，deployment 中的 {model} 替换为请求的模型名称；为空时拒绝
+	Retry         RetryConfig             `mapstructure:"retry"`
+	Transport     TransportConfig         `mapstructure:"transport"`
+	HealthCheck   HealthCheckConfig       `mapstructure:"health_check"`
+	Auth          AuthConfig              `mapstructure:"auth"`
+	IPAllowlist   IPAllowlistConfig       `mapstructure:"ip_allowlist"`
+	Logging       LoggingConfig           `mapstructure:"logging"`
+	Pricing       map[string]ModelPricing `mapstructure:"pricing"`
+	LoadBalancer  LoadBalancerConfig      `mapstructure:"loadbalancer"`
+	Webhook       WebhookConfig           `mapstructure:"webhook"`
+	Mirror        MirrorConfig            `mapstructure:"mirror"`
+	OpenAIHeaders OpenAIHeadersConfig     `mapstructure:"openai_headers"`
+	Params        ParamsConfig            `mapstructure:"params"`
+	Embeddings    EmbeddingsConfig        `mapstructure:"embeddings"`
+	Images        ImagesConfig            `mapstructure:"images"`
+	ContentSafety ContentSafetyConfig     `mapstructure:"content_safety"`
+	Coalescing    CoalescingConfig        `mapstructure:"coalescing"`
+	Attribution   UsageAttributionConfig  `mapstructure:"usage_attribution"`
+	// Transforms 请求体转换器名称列表，按顺序执行
+	Transforms []string `mapstructure:"transforms"`
 }
 
 var AppConfig *Config
 
+// Load 读取并校验配置文件，成功后设置为全局配置 AppConfig
+// configPath 可以是逗号分隔的多个文件或目录，按顺序合并（见 mergeSettings）
 func Load(configPath string) error {
+	cfg, err := Read(configPath)
+	if err != nil {
+		return err
+	}
+	AppConfig = cfg
+	return nil
+}
+
+// Read 读取并校验配置文件，不修改全局配置（用于热加载）
+func Read(configPath string) (*Config, error) {
+	files, err := configFiles(configPath)
+	if err != nil {
+		return nil, err
+	}
+
 	v := viper.NewWithOptions(viper.KeyDelimiter("::"))
-	v.SetConfigFile(configPath)
-	v.SetConfigType("yaml")
 
 	// 设置默认值
 	v.SetDefault("server::port", 8080)
+	v.SetDefault("server::stream_error_event", true)
+	v.SetDefault("server::max_stream_event_size", 1024*1024)
+	v.SetDefault("server::oversized_stream_event", OversizedStreamEventPassthrough)
+	v.SetDefault("server::read_timeout", "60s")
+	v.SetDefault("server::response_compression::min_size_kb", 64)
 	v.SetDefault("retry::max_attempts", 3)
 	v.SetDefault("retry::timeout", "30s")
+	v.SetDefault("retry::stream_timeout", "10m")
+	v.SetDefault("retry::max_backoff", "5s")
+	v.SetDefault("retry::per_backend_attempts", 1)
+	v.SetDefault("transport::http2", "auto")
+	v.SetDefault("transport::dial_timeout", "5s")
+	v.SetDefault("transport::tls_handshake_timeout", "10s")
+	v.SetDefault("health_check::interval", "10s")
+	v.SetDefault("health_check::probe_timeout", "5s")
+	v.SetDefault("health_check::probe_attempts", 3)
+	v.SetDefault("health_check::probe_backoff", "500ms")
+	v.SetDefault("health_check::healthy_threshold", 1)
+	v.SetDefault("loadbalancer::passive_health", true)
+	v.SetDefault("loadbalancer::strategy", StrategyRoundRobin)
+	v.SetDefault("loadbalancer::exclude_header", "disabled")
+	v.SetDefault("usage_attribution::default_bucket", "unattributed")
+	v.SetDefault("transforms", []string{"reject_params", "max_tokens", "unsupported_params"})
+	v.SetDefault("params::strip", []string{"chat_template_kwargs", "enable_thinking", "thinking"})
+	v.SetDefault("embeddings::max_concurrency", 4)
+	v.SetDefault("images::max_size_mb", 5)
+	v.SetDefault("images::max_images", 10)
+	v.SetDefault("images::fetch_timeout", "10s")
+	v.SetDefault("content_safety::timeout", "5s")
+	v.SetDefault("webhook::timeout", "5s")
+	v.SetDefault("webhook::max_retries", 3)
+	v.SetDefault("webhook::min_interval", "1m")
+	v.SetDefault("mirror::path", "mirror/requests.jsonl")
+	v.SetDefault("mirror::sample_rate", 0.01)
+	v.SetDefault("mirror::max_size_mb", 100)
+	v.SetDefault("mirror::max_backups", 3)
+	v.SetDefault("mirror::buffer_size", 1000)
+	v.SetDefault("logging::level", "info")
+	v.SetDefault("logging::format", "json")
+	v.SetDefault("logging::time_format", "iso8601")
+	v.SetDefault("logging::request_sample_rate", 1.0)
+	v.SetDefault("logging::key_mask_prefix", 4)
+	v.SetDefault("logging::key_mask_min_length", 12)
+	v.SetDefault("logging::access_log_format", "json")
 
-	if err := v.ReadInConfig(); err != nil {
-		return err
+	settings, err := readSettings(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.MergeConfigMap(settings); err != nil {
+		return nil, err
 	}
 
-	AppConfig = &Config{}
-	if err := v.Unmarshal(AppConfig); err != nil {
-		return err
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, err
 	}
+	cfg.expandDeployments()
+	cfg.normalizeDefaultModel()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验配置的合法性
+func (c *Config) Validate() error {
+	for i, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("server.trusted_proxies[%d]: %q is not a valid IP or CIDR", i, proxy)
+		}
+	}
+	if c.Server.ReadTimeout < 0 {
+		return fmt.Errorf("server.read_timeout must not be negative")
+	}
+	if c.IPAllowlist.TrustedProxyCount < 0 {
+		return fmt.Errorf("ip_allowlist.trusted_proxy_count must not be negative")
+	}
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("logging.level %q is invalid, must be one of debug/info/warn/error", c.Logging.Level)
+	}
+	if c.Logging.BodySampleRate < 0 || c.Logging.BodySampleRate > 1 {
+		return fmt.Errorf("logging.body_sample_rate must be between 0 and 1")
+	}
+	if c.Logging.RequestSampleRate < 0 || c.Logging.RequestSampleRate > 1 {
+		return fmt.Errorf("logging.request_sample_rate must be between 0 and 1")
+	}
+	if c.Logging.SlowRequestThreshold < 0 {
+		return fmt.Errorf("logging.slow_request_threshold must not be negative")
+	}
+	if c.Logging.KeyMaskPrefix < 0 || c.Logging.KeyMaskMinLength < 0 {
+		return fmt.Errorf("logging.key_mask_prefix/key_mask_min_length must not be negative")
+	}
+	switch c.Logging.Format {
+	case "json", "console":
+	default:
+		return fmt.Errorf("logging.format %q is invalid, must be json or console", c.Logging.Format)
+	}
+	switch c.Logging.AccessLogFormat {
+	case "json", "combined":
+	default:
+		return fmt.Errorf("logging.access_log_format %q is invalid, must be json or combined", c.Logging.AccessLogFormat)
+	}
+	switch c.Logging.TimeFormat {
+	case "iso8601", "rfc3339", "rfc3339nano", "epoch", "epoch_millis":
+	default:
+		return fmt.Errorf("logging.time_format %q is invalid, must be one of iso8601/rfc3339/rfc3339nano/epoch/epoch_millis", c.Logging.TimeFormat)
+	}
+	if c.Retry.Backoff < 0 || c.Retry.MaxBackoff < 0 || c.Retry.MaxElapsed < 0 {
+		return fmt.Errorf("retry.backoff, max_backoff and max_elapsed must not be negative")
+	}
+	if c.Retry.Jitter < 0 || c.Retry.Jitter > 1 {
+		return fmt.Errorf("retry.jitter must be between 0 and 1")
+	}
+	if p := c.Server.StreamPacing; p.BytesPerSecond < 0 || p.EventsPerSecond < 0 {
+		return fmt.Errorf("server.stream_pacing values must not be negative")
+	}
+	if c.Server.MaxStreamEventSize < 0 {
+		return fmt.Errorf("server.max_stream_event_size must not be negative")
+	}
+	switch c.Server.OversizedStreamEvent {
+	case OversizedStreamEventPassthrough, OversizedStreamEventTruncate, OversizedStreamEventError:
+	default:
+		return fmt.Errorf("server.oversized_stream_event %q is invalid, must be one of passthrough/truncate/error", c.Server.OversizedStreamEvent)
+	}
+	if c.Server.ResponseCompression.MinSizeKB < 0 {
+		return fmt.Errorf("server.response_compression.min_size_kb must not be negative")
+	}
+	if c.Retry.PerBackendAttempts < 1 {
+		return fmt.Errorf("retry.per_backend_attempts must be at least 1")
+	}
+	if t := c.Retry.Timeouts; t.ChatCompletions < 0 || t.Embeddings < 0 || t.Responses < 0 {
+		return fmt.Errorf("retry.timeouts must not be negative")
+	}
+	if c.Server.MaxInFlight < 0 {
+		return fmt.Errorf("server.max_in_flight must not be negative")
+	}
+	if c.HealthCheck.Interval <= 0 {
+		return fmt.Errorf("health_check.interval must be positive")
+	}
+	// /admin/backends/recheck、latency_probe 与 --check-probe 不受 probe 开关影响，始终校验
+	if c.HealthCheck.ProbeAttempts < 1 || c.HealthCheck.ProbeTimeout <= 0 {
+		return fmt.Errorf("health_check.probe_attempts and probe_timeout must be positive")
+	}
+	if c.HealthCheck.HealthyThreshold < 1 {
+		return fmt.Errorf("health_check.healthy_threshold must be at least 1")
+	}
+	switch c.Transport.HTTP2 {
+	case "auto", "force", "disabled":
+	default:
+		return fmt.Errorf("transport.http2 %q is invalid, must be one of auto/force/disabled", c.Transport.HTTP2)
+	}
+	if c.Transport.H2C && c.Transport.HTTP2 != "force" {
+		return fmt.Errorf("transport.h2c requires transport.http2 to be force")
+	}
+	if c.Transport.DialTimeout <= 0 || c.Transport.TLSHandshakeTimeout <= 0 {
+		return fmt.Errorf("transport.dial_timeout and tls_handshake_timeout must be positive")
+	}
+	if _, ok := c.configuredModel(c.DefaultModel); c.DefaultModel != "" && !ok {
+		return fmt.Errorf("default_model %q is not configured in models", c.DefaultModel)
+	}
+	if !validStrategy(c.LoadBalancer.Strategy) {
+		return fmt.Errorf("loadbalancer.strategy %q is invalid, must be one of round_robin/weighted/least_conn/random/hash/latency_aware/locality", c.LoadBalancer.Strategy)
+	}
+	switch c.LoadBalancer.ExcludeHeader {
+	case "disabled", "admin", "all":
+	default:
+		return fmt.Errorf("loadbalancer.exclude_header %q is invalid, must be one of disabled/admin/all", c.LoadBalancer.ExcludeHeader)
+	}
+	if c.LoadBalancer.CircuitCooldown < 0 {
+		return fmt.Errorf("loadbalancer.circuit_cooldown must not be negative")
+	}
+	for i, route := range c.LoadBalancer.BodyRoutes {
+		if strings.TrimSpace(route.Field) == "" {
+			return fmt.Errorf("loadbalancer.body_routes[%d]: field is required", i)
+		}
+		if len(route.Values) == 0 {
+			return fmt.Errorf("loadbalancer.body_routes[%d]: values must not be empty", i)
+		}
+		for value, tag := range route.Values {
+			if tag == "" {
+				return fmt.Errorf("loadbalancer.body_routes[%d]: tag for value %q must not be empty", i, value)
+			}
+		}
+	}
+	for model, modelCfg := range c.Models {
+		if err := validateModelConfig("models."+model, modelCfg); err != nil {
+			return err
+		}
+		if modelCfg.Strategy == StrategyLocality && c.LoadBalancer.Locality == "" {
+			return fmt.Errorf("models.%s.strategy locality requires loadbalancer.locality", model)
+		}
+	}
+	if c.LoadBalancer.Strategy == StrategyLocality && c.LoadBalancer.Locality == "" {
+		return fmt.Errorf("loadbalancer.strategy locality requires loadbalancer.locality")
+	}
+	if c.CatchAll != nil {
+		if len(c.CatchAll.Backends) == 0 {
+			return fmt.Errorf("catch_all.backends must not be empty")
+		}
+		if err := validateModelConfig("catch_all", *c.CatchAll); err != nil {
+			return err
+		}
+		if c.CatchAll.Strategy == StrategyLocality && c.LoadBalancer.Locality == "" {
+			return fmt.Errorf("catch_all.strategy locality requires loadbalancer.locality")
+		}
+	}
+	for model, price := range c.Pricing {
+		if price.Input < 0 || price.Output < 0 {
+			return fmt.Errorf("pricing.%s: prices must not be negative", model)
+		}
+	}
+	if c.Webhook.MaxRetries < 0 {
+		return fmt.Errorf("webhook.max_retries must not be negative")
+	}
+	if c.Mirror.Enabled {
+		if c.Mirror.SampleRate < 0 || c.Mirror.SampleRate > 1 {
+			return fmt.Errorf("mirror.sample_rate must be between 0 and 1")
+		}
+		if c.Mirror.MaxSizeMB <= 0 || c.Mirror.MaxBackups < 0 || c.Mirror.BufferSize <= 0 {
+			return fmt.Errorf("mirror.max_size_mb and mirror.buffer_size must be positive, mirror.max_backups must not be negative")
+		}
+	}
+	if c.Embeddings.SplitBatchSize < 0 {
+		return fmt.Errorf("embeddings.split_batch_size must not be negative")
+	}
+	if c.Embeddings.SplitBatchSize > 0 && c.Embeddings.MaxConcurrency <= 0 {
+		return fmt.Errorf("embeddings.max_concurrency must be positive")
+	}
+	if c.Images.Inline && (c.Images.MaxSizeMB <= 0 || c.Images.MaxImages <= 0 || c.Images.FetchTimeout <= 0) {
+		return fmt.Errorf("images.max_size_mb, max_images and fetch_timeout must be positive")
+	}
+	for i, host := range c.Images.AllowedHosts {
+		if host == "" || strings.ContainsAny(host, "/:") {
+			return fmt.Errorf("images.allowed_hosts[%d]: %q must be a host name such as example.com or *.example.com", i, host)
+		}
+	}
+	for i, pattern := range c.ContentSafety.DenyPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("content_safety.deny_patterns[%d]: %w", i, err)
+		}
+	}
+	if c.ContentSafety.Endpoint != "" && c.ContentSafety.Timeout <= 0 {
+		return fmt.Errorf("content_safety.timeout must be positive")
+	}
+	for i, header := range c.Attribution.Headers {
+		if strings.TrimSpace(header) == "" {
+			return fmt.Errorf("usage_attribution.headers[%d] must not be empty", i)
+		}
+	}
+	for i, rule := range c.Params.Reject {
+		if rule.Param == "" {
+			return fmt.Errorf("params.reject[%d]: param is required", i)
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return fmt.Errorf("params.reject[%d]: min must not be greater than max", i)
+		}
+	}
+	for param, r := range c.Params.Clamp {
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("params.clamp.%s: min must not be greater than max", param)
+		}
+	}
+	for i, path := range c.Auth.ExemptPaths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("auth.exempt_paths[%d]: path must start with /", i)
+		}
+	}
+	for i, k := range c.Auth.Keys {
+		if (k.Key == "") == (k.KeyHash == "") {
+			return fmt.Errorf("auth.keys[%d]: exactly one of key and key_hash must be set", i)
+		}
+		if k.KeyHash != "" {
+			if err := validateKeyHash(k.KeyHash); err != nil {
+				return fmt.Errorf("auth.keys[%d].key_hash: %w", i, err)
+			}
+		}
+		if k.MaxConcurrent < 0 {
+			return fmt.Errorf("auth.keys[%d].max_concurrent must not be negative", i)
+		}
+		for model, pin := range k.Pins {
+			modelCfg, ok := c.Models[model]
+			if !ok {
+				return fmt.Errorf("auth.keys[%d].pins: model %q is not configured in models", i, model)
+			}
+			if len(modelCfg.PinnedBackends(pin)) == 0 {
+				return fmt.Errorf("auth.keys[%d].pins.%s: no backend matches %q (use a backend index or endpoint)", i, model, pin)
+			}
+		}
+	}
+	for group := range c.IPAllowlist.Groups {
+		if _, err := c.IPAllowlist.Networks(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// validateModelConfig 校验单个模型（或 catch_all）的配置，path 为错误信息中的配置路径
+func validateModelConfig(path string, modelCfg ModelConfig) error {
+	if modelCfg.Strategy != "" && !validStrategy(modelCfg.Strategy) {
+		return fmt.Errorf("%s.strategy %q is invalid, must be one of round_robin/weighted/least_conn/random/hash/latency_aware/locality", path, modelCfg.Strategy)
+	}
+	if modelCfg.MaxStreamDuration < 0 || modelCfg.MaxStreamBytes < 0 {
+		return fmt.Errorf("%s: max_stream_duration/max_stream_bytes must not be negative", path)
+	}
+	for apiType, tmpl := range modelCfg.URLTemplates {
+		if !urlTemplateAPITypes[apiType] {
+			return fmt.Errorf("%s.url_templates: unknown api type %q, must be one of chat/completions, completions, embeddings, responses, audio/speech", path, apiType)
+		}
+		if !strings.Contains(tmpl, "{endpoint}") {
+			return fmt.Errorf("%s.url_templates.%s: template must contain {endpoint}", path, apiType)
+		}
+	}
+	for i, backend := range modelCfg.Backends {
+		if u, err := url.Parse(backend.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s.backends[%d]: endpoint must be an absolute http(s) URL", path, i)
+		}
+		if ad := backend.AzureAD; ad != nil && (ad.TenantID == "" || ad.ClientID == "" || ad.ClientSecret == "") {
+			return fmt.Errorf("%s.backends[%d]: azure_ad requires tenant_id, client_id and client_secret", path, i)
+		}
+		if backend.TLS != nil {
+			if _, err := backend.TLS.ClientConfig(); err != nil {
+				return fmt.Errorf("%s.backends[%d].tls: %w", path, i, err)
+			}
+		}
+		if backend.MaxRPM < 0 || backend.MaxTPM < 0 || backend.MaxConcurrent < 0 {
+			return fmt.Errorf("%s.backends[%d]: max_rpm/max_tpm/max_concurrent must not be negative", path, i)
+		}
+		if backend.Weight < 0 {
+			return fmt.Errorf("%s.backends[%d]: weight must not be negative", path, i)
+		}
+		switch backend.Type {
+		case "", BackendTypeAzure:
+		case BackendTypeOpenAI:
+			if backend.AzureAD != nil || backend.GzipRequests {
+				return fmt.Errorf("%s.backends[%d]: azure_ad and gzip_requests are not supported for openai backends", path, i)
+			}
+		default:
+			return fmt.Errorf("%s.backends[%d]: type %q is invalid, must be azure or openai", path, i, backend.Type)
+		}
+	}
 	return nil
 }
 
+// Networks 解析指定路由组的 CIDR 列表，单个 IP 视为 /32 或 /128
+func (a *IPAllowlistConfig) Networks(group string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range a.Groups[group] {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("ip_allowlist.groups.%s: invalid ip %q", group, entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("ip_allowlist.groups.%s: invalid cidr %q: %w", group, entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
 // GetBackendsForModel 获取指定模型的后端列表
 func (c *Config) GetBackendsForModel(model string) []Backend {
 	if modelConfig, ok := c.Models[model]; ok {
@@ -78,20 +1060,121 @@ func (c *Config) GetBackendsForModel(model string) []Backend {
 	return nil
 }
 
+// EstimateCost 按价格表估算请求成本（美元），模型未配置价格时返回 false
+func (c *Config) EstimateCost(model string, promptTokens, completionTokens int) (float64, bool) {
+	price, ok := c.Pricing[model]
+	if !ok {
+		return 0, false
+	}
+	return float64(promptTokens)/1000*price.Input + float64(completionTokens)/1000*price.Output, true
+}
+
 // IsAuthEnabled 检查是否启用认证
 func (c *Config) IsAuthEnabled() bool {
 	return c.Auth.Enabled && len(c.Auth.Keys) > 0
 }
 
+// IsAdminKey 检查该名称的 key 是否为管理员 key，未启用认证时没有管理员
+func (c *Config) IsAdminKey(name string) bool {
+	if !c.IsAuthEnabled() || name == "" {
+		return false
+	}
+	for _, k := range c.Auth.Keys {
+		if k.Name == name {
+			return k.Admin
+		}
+	}
+	return false
+}
+
+// KeyTier 返回该名称的 key 所属的层级，未启用认证或未配置时为空
+func (c *Config) KeyTier(name string) string {
+	if !c.IsAuthEnabled() || name == "" {
+		return ""
+	}
+	for _, k := range c.Auth.Keys {
+		if k.Name == name {
+			return k.Tier
+		}
+	}
+	return ""
+}
+
+// KeyMaxConcurrent 返回该名称的 key 的并发请求数上限，未启用认证或未配置时为 0（不限制）
+func (c *Config) KeyMaxConcurrent(name string) int {
+	if !c.IsAuthEnabled() || name == "" {
+		return 0
+	}
+	for _, k := range c.Auth.Keys {
+		if k.Name == name {
+			return k.MaxConcurrent
+		}
+	}
+	return 0
+}
+
+// KeyPin 返回该名称的 key 为模型固定的后端（backends 下标或 endpoint），未启用认证或未配置时为空
+func (c *Config) KeyPin(name, model string) string {
+	if !c.IsAuthEnabled() || name == "" {
+		return ""
+	}
+	for _, k := range c.Auth.Keys {
+		if k.Name == name {
+			return k.Pins[model]
+		}
+	}
+	return ""
+}
+
+// expandDeployments 将后端 deployment 中的 {model} 替换为所属模型的名称（小写）
+func (c *Config) expandDeployments() {
+	for model, modelCfg := range c.Models {
+		for i := range modelCfg.Backends {
+			modelCfg.Backends[i].Deployment = strings.ReplaceAll(modelCfg.Backends[i].Deployment, "{model}", model)
+		}
+	}
+}
+
+// configuredModel 按忽略大小写查找已配置的模型（模型名称由 viper 读取为小写），返回配置中的名称
+func (c *Config) configuredModel(model string) (string, bool) {
+	for name := range c.Models {
+		if strings.EqualFold(name, model) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// normalizeDefaultModel 将 default_model 改写为配置中的模型名称，
+// 请求按精确名称查找模型，否则 default_model: GPT-4o 在未开启 case_insensitive_models 时无法匹配读取为小写的 gpt-4o
+func (c *Config) normalizeDefaultModel() {
+	if name, ok := c.configuredModel(c.DefaultModel); ok {
+		c.DefaultModel = name
+	}
+}
+
+// SkipsContentSafety 检查该名称的 key 是否跳过 content_safety 检查
+func (c *Config) SkipsContentSafety(name string) bool {
+	if !c.IsAuthEnabled() || name == "" {
+		return false
+	}
+	for _, k := range c.Auth.Keys {
+		if k.Name == name {
+			return k.SkipContentSafety
+		}
+	}
+	return false
+}
+
 // ValidateAPIKey 验证 API Key，返回 key 名称和是否有效
-// 使用常量时间比较防止时序攻击
+// 明文与 sha256 哈希使用常量时间比较防止时序攻击，bcrypt 本身的比较也是常量时间的
 func (c *Config) ValidateAPIKey(key string) (string, bool) {
 	if !c.IsAuthEnabled() {
 		return "", true
 	}
 
 	for _, k := range c.Auth.Keys {
-		if subtle.ConstantTimeCompare([]byte(key), []byte(k.Key)) == 1 {
+		if k.matches(key) {
 			return k.Name, true
 		}
 	}
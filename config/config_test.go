@@ -0,0 +1,56 @@
+package config
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestReadNormalizesDefaultModel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+default_model: GPT-4o
+models:
+  GPT-4o:
+    backends:
+      - endpoint: "https://example.openai.azure.com"
+        api_key: test
+        deployment: gpt-4o
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	// 模型名称由 viper 读取为小写，default_model 须与之一致，请求才能按精确名称找到模型
+	if _, ok := cfg.Models[cfg.DefaultModel]; !ok {
+		t.Errorf("default_model = %q, not a configured model key (models: %v)", cfg.DefaultModel, cfg.Models)
+	}
+}
+
+func TestBcryptKeyMissCached(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("sk-right"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := APIKeyConfig{Name: "bcrypt", KeyHash: string(hash)}
+
+	if k.matches("sk-wrong") {
+		t.Fatal("wrong key matched")
+	}
+	digest := sha256.Sum256([]byte("sk-wrong"))
+	if !bcryptMisses.contains(k.KeyHash + "\x00" + string(digest[:])) {
+		t.Error("failed bcrypt comparison was not cached")
+	}
+	if k.matches("sk-wrong") {
+		t.Error("cached miss matched")
+	}
+	if !k.matches("sk-right") {
+		t.Error("correct key did not match")
+	}
+}
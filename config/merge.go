@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// configFiles 解析 --config 参数：多个路径以逗号分隔，目录展开为其中按文件名排序的 .yaml/.yml 文件，
+// 远程配置源（http(s)/consul/etcd）原样保留
+func configFiles(configPath string) ([]string, error) {
+	var files []string
+	for _, path := range strings.Split(configPath, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if isRemoteSource(path) {
+			files = append(files, path)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("no .yaml or .yml files in config directory %s", path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config file specified")
+	}
+	return files, nil
+}
+
+// readSettings 依次读取配置文件并合并，后面的文件覆盖前面的文件
+func readSettings(files []string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for _, file := range files {
+		v := viper.NewWithOptions(viper.KeyDelimiter("::"))
+		v.SetConfigType("yaml")
+		if isRemoteSource(file) {
+			data, err := fetchRemote(file)
+			if err != nil {
+				return nil, err
+			}
+			if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		} else {
+			v.SetConfigFile(file)
+			if err := v.ReadInConfig(); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		mergeSettings(merged, v.AllSettings(), nil)
+	}
+	return merged, nil
+}
+
+// mergeSettings 将 src 合并到 dst：map 逐个 key 递归合并，列表整体替换，
+// 但以下列表按标识合并（相同标识的条目逐字段覆盖，新条目追加到末尾）：
+//   - models.<model>.backends：按 endpoint + deployment
+//   - auth.keys：按 name
+func mergeSettings(dst, src map[string]interface{}, path []string) {
+	for key, value := range src {
+		keyPath := append(path[:len(path):len(path)], key)
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if existing, ok := dst[key].(map[string]interface{}); ok {
+				mergeSettings(existing, value, keyPath)
+				continue
+			}
+		case []interface{}:
+			if identity := listIdentity(keyPath); identity != nil {
+				if existing, ok := dst[key].([]interface{}); ok {
+					dst[key] = mergeList(existing, value, identity, keyPath)
+					continue
+				}
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// listIdentity 返回按标识合并的列表的条目标识函数，其他列表返回 nil
+func listIdentity(keyPath []string) func(map[string]interface{}) string {
+	switch {
+	case len(keyPath) == 3 && keyPath[0] == "models" && keyPath[2] == "backends":
+		return func(item map[string]interface{}) string {
+			return fmt.Sprint(item["endpoint"]) + "|" + fmt.Sprint(item["deployment"])
+		}
+	case len(keyPath) == 2 && keyPath[0] == "auth" && keyPath[1] == "keys":
+		return func(item map[string]interface{}) string {
+			name, _ := item["name"].(string)
+			return name
+		}
+	}
+	return nil
+}
+
+// mergeList 按标识合并列表条目，标识为空的条目直接追加
+func mergeList(dst, src []interface{}, identity func(map[string]interface{}) string, keyPath []string) []interface{} {
+	index := make(map[string]map[string]interface{}, len(dst))
+	for _, item := range dst {
+		if m, ok := item.(map[string]interface{}); ok {
+			if id := identity(m); id != "" {
+				index[id] = m
+			}
+		}
+	}
+
+	for _, item := range src {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			dst = append(dst, item)
+			continue
+		}
+		id := identity(m)
+		if existing, ok := index[id]; ok && id != "" {
+			mergeSettings(existing, m, keyPath)
+			continue
+		}
+		dst = append(dst, m)
+		if id != "" {
+			index[id] = m
+		}
+	}
+	return dst
+}
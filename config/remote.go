@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remoteFetchTimeout 读取单个远程配置源的超时
+const remoteFetchTimeout = 10 * time.Second
+
+// maxRemoteConfigSize 远程配置内容的大小上限
+const maxRemoteConfigSize = 4 << 20
+
+var remoteClient = &http.Client{Timeout: remoteFetchTimeout}
+
+// ErrRemoteUnreachable 无法读取远程配置源（网络错误、非 200 响应或 key 不存在）
+var ErrRemoteUnreachable = errors.New("remote config source unreachable")
+
+// isRemoteSource 检查 --config 中的一项是否为远程配置源
+//   - http(s)://host/path：GET 该地址，响应体为 YAML
+//   - consul://host:port/key：读取 Consul KV（HTTP API），CONSUL_HTTP_TOKEN 环境变量作为 ACL token
+//   - etcd://host:port/key：读取 etcd v3 KV（gRPC gateway 的 JSON API）
+//
+// consul+https:// 与 etcd+https:// 使用 HTTPS 访问；CONSUL_HTTP_SSL=true 时 consul:// 也使用 HTTPS
+func isRemoteSource(path string) bool {
+	for _, scheme := range []string{"http://", "https://", "consul://", "etcd://", "consul+https://", "etcd+https://"} {
+		if strings.HasPrefix(strings.ToLower(path), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRemoteSource 检查 --config 是否包含远程配置源，包含时需要轮询变化
+func HasRemoteSource(configPath string) bool {
+	for _, path := range strings.Split(configPath, ",") {
+		if isRemoteSource(strings.TrimSpace(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteFingerprint 读取 --config 中的所有远程配置源，返回内容的摘要，用于判断远程配置是否变化
+func RemoteFingerprint(configPath string) (string, error) {
+	hash := sha256.New()
+	for _, path := range strings.Split(configPath, ",") {
+		path = strings.TrimSpace(path)
+		if !isRemoteSource(path) {
+			continue
+		}
+		data, err := fetchRemote(path)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(path + "\x00"))
+		hash.Write(data)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fetchRemote 读取远程配置源的内容
+func fetchRemote(source string) ([]byte, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config source %s: %w", source, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	scheme, secure := strings.CutSuffix(strings.ToLower(u.Scheme), "+https")
+	httpScheme := "http"
+	if secure {
+		httpScheme = "https"
+	}
+
+	var data []byte
+	switch scheme {
+	case "http", "https":
+		if secure {
+			return nil, fmt.Errorf("unsupported config source %s", u.Redacted())
+		}
+		data, err = httpGet(source, nil)
+	case "consul":
+		if key == "" {
+			return nil, fmt.Errorf("config source %s: consul key is required", u.Redacted())
+		}
+		if ssl, _ := strconv.ParseBool(os.Getenv("CONSUL_HTTP_SSL")); ssl {
+			httpScheme = "https"
+		}
+		header := http.Header{}
+		if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+			// ACL token 不通过明文 HTTP 发送到本机以外的地址
+			if httpScheme == "http" && !isLoopbackHost(u.Hostname()) {
+				return nil, fmt.Errorf("config source %s: refusing to send CONSUL_HTTP_TOKEN over plain HTTP to a non-loopback host, use consul+https:// or CONSUL_HTTP_SSL=true", u.Redacted())
+			}
+			header.Set("X-Consul-Token", token)
+		}
+		data, err = httpGet(fmt.Sprintf("%s://%s/v1/kv/%s?raw", httpScheme, u.Host, key), header)
+	case "etcd":
+		if key == "" {
+			return nil, fmt.Errorf("config source %s: etcd key is required", u.Redacted())
+		}
+		data, err = etcdGet(httpScheme+"://"+u.Host, key)
+	default:
+		return nil, fmt.Errorf("unsupported config source %s", u.Redacted())
+	}
+	if err != nil {
+		// 错误信息中隐藏 URL 中的凭据
+		return nil, fmt.Errorf("%w: %s: %v", ErrRemoteUnreachable, u.Redacted(), err)
+	}
+	return data, nil
+}
+
+func httpGet(target string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readRemoteBody(resp)
+}
+
+// isLoopbackHost 检查主机名是否为本机地址（localhost 或回环 IP）
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// etcdGet 通过 etcd v3 的 JSON API 读取单个 key，key 与 value 均为 base64 编码
+func etcdGet(baseURL, key string) ([]byte, error) {
+	payload, _ := json.Marshal(map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(key)),
+	})
+	resp, err := remoteClient.Post(baseURL+"/v3/kv/range", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readRemoteBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Kvs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid etcd response: %w", err)
+	}
+	if len(result.Kvs) == 0 {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	return base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+}
+
+func readRemoteBody(resp *http.Response) ([]byte, error) {
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("config exceeds %d bytes", maxRemoteConfigSize)
+	}
+	return body, nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchRemoteConsulToken(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_TOKEN", "secret")
+
+	// 明文 HTTP 访问非本机地址时在发送请求前报错
+	_, err := fetchRemote("consul://consul.example.com:8500/azure-proxy/config")
+	if err == nil || !strings.Contains(err.Error(), "plain HTTP") {
+		t.Errorf("plain HTTP to remote host: err = %v, want refusal", err)
+	}
+
+	var token string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Consul-Token")
+		w.Write([]byte("models: {}\n"))
+	}))
+	defer server.Close()
+	orig := remoteClient
+	remoteClient = server.Client()
+	defer func() { remoteClient = orig }()
+
+	source := "consul+https://" + strings.TrimPrefix(server.URL, "https://") + "/azure-proxy/config"
+	if !isRemoteSource(source) {
+		t.Fatalf("%s is not recognized as a remote source", source)
+	}
+	data, err := fetchRemote(source)
+	if err != nil {
+		t.Fatalf("consul+https: %v", err)
+	}
+	if string(data) != "models: {}\n" || token != "secret" {
+		t.Errorf("data = %q, token = %q", data, token)
+	}
+}
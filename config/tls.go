@@ -0,0 +1,54 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// BackendTLSConfig 单个后端的 TLS 配置，用于私有 CA、mTLS 等场景
+type BackendTLSConfig struct {
+	CAFile   string `mapstructure:"ca_file"`   // PEM 格式的 CA 证书，追加到系统根证书之后
+	CertFile string `mapstructure:"cert_file"` // mTLS 客户端证书，需与 key_file 同时配置
+	KeyFile  string `mapstructure:"key_file"`
+	// ServerName 覆盖证书校验使用的主机名（endpoint 为 IP 或经内部代理访问时）
+	ServerName string `mapstructure:"server_name"`
+	// InsecureSkipVerify 跳过证书校验，仅用于排查问题，启用时输出警告日志
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+// ClientConfig 读取证书文件并构建 tls.Config
+func (t BackendTLSConfig) ClientConfig() (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s contains no valid PEM certificates", t.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, fmt.Errorf("cert_file and key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/loadbalancer"
+	"azure-openai-proxy/middleware"
+	"azure-openai-proxy/stats"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const warmupTimeout = 10 * time.Second
+
+// warmupResult 单个端点的预热结果
+type warmupResult struct {
+	Endpoint  string   `json:"endpoint"`
+	Models    []string `json:"models"`
+	Warmed    bool     `json:"warmed"`
+	Status    int      `json:"status,omitempty"`
+	LatencyMs int64    `json:"latency_ms"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// HandleWarmup 预热接口：向每个后端端点发送一个轻量请求，提前建立 DNS/TLS 连接并放入连接池
+// 连接池按 host 复用，因此同一端点只请求一次
+func (h *ProxyHandler) HandleWarmup(c *gin.Context) {
+	type target struct {
+		backend config.Backend
+		models  []string
+	}
+	// 直接遍历配置，懒加载模式下尚未初始化的模型同样需要预热
+	targets := make(map[string]*target)
+	for model, modelCfg := range h.lb.ModelConfigs() {
+		for _, backend := range modelCfg.Backends {
+			endpoint := strings.TrimSuffix(backend.Endpoint, "/")
+			t, ok := targets[endpoint]
+			if !ok {
+				t = &target{backend: backend}
+				targets[endpoint] = t
+			}
+			t.models = append(t.models, model)
+		}
+	}
+
+	results := make([]warmupResult, 0, len(targets))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			sort.Strings(t.models)
+			result := h.warmupBackend(c.Request.Context(), t.backend)
+			result.Models = t.models
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(t)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Endpoint < results[j].Endpoint
+	})
+
+	warmed := 0
+	for _, r := range results {
+		if r.Warmed {
+			warmed++
+		}
+	}
+
+	h.logger.Info("backend warmup finished",
+		zap.Int("total", len(results)),
+		zap.Int("warmed", warmed),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   len(results),
+		"warmed":  warmed,
+		"results": results,
+	})
+}
+
+// warmupBackend 通过共享 client 请求后端的模型列表接口
+// 只要收到 HTTP 响应（即使是 4xx）即说明连接已建立，5xx 视为预热失败
+func (h *ProxyHandler) warmupBackend(ctx context.Context, backend config.Backend) warmupResult {
+	result := warmupResult{Endpoint: loadbalancer.MaskEndpoint(backend.Endpoint)}
+
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	status, err := h.pingBackend(ctx, backend)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		h.logger.Warn("backend warmup failed",
+			zap.String("endpoint", result.Endpoint),
+			zap.Error(err),
+		)
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = status
+	result.Warmed = status < http.StatusInternalServerError
+	if !result.Warmed {
+		result.Error = fmt.Sprintf("backend returned status %d", status)
+	}
+	return result
+}
+
+// pingBackend 请求后端的模型列表接口，返回响应状态码
+// 用于预热和健康探测，请求很轻量且不消耗 token
+func (h *ProxyHandler) pingBackend(ctx context.Context, backend config.Backend) (int, error) {
+	targetURL := fmt.Sprintf("%s/openai/models?api-version=%s",
+		strings.TrimSuffix(backend.Endpoint, "/"), backendAPIVersion(backend))
+	if backend.IsOpenAI() {
+		targetURL = strings.TrimSuffix(backend.Endpoint, "/") + "/models"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := h.setBackendAuth(ctx, req.Header, backend); err != nil {
+		return 0, err
+	}
+
+	client, err := h.backendClient(h.client, backend)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// 读完响应体，连接才能放回连接池复用
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// HandleSetModelEnabled 返回启用/禁用模型的管理接口，只修改运行时状态，热加载配置后恢复为配置中的 enabled
+func (h *ProxyHandler) HandleSetModelEnabled(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model := c.Param("model")
+		if !h.lb.SetModelEnabled(model, enabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %s is not configured", model)})
+			return
+		}
+		h.logger.Warn("model state changed by admin",
+			zap.String("model", model),
+			zap.Bool("enabled", enabled),
+		)
+		c.JSON(http.StatusOK, gin.H{"model": model, "enabled": enabled})
+	}
+}
+
+// HandleRecheckBackends 立即主动探测所有后端，探测成功的不健康后端直接恢复，返回探测后各模型后端的健康状态
+// 用于已知的区域故障恢复后立即恢复流量，不必等待恢复超时
+func (h *ProxyHandler) HandleRecheckBackends(c *gin.Context) {
+	h.logger.Warn("backend recheck triggered by admin",
+		zap.String("key", c.GetString(middleware.ContextKeyAPIKeyName)),
+	)
+	recovered, failed := h.lb.Recheck(h)
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovered": recovered,
+		"unhealthy": failed,
+		"models":    h.backendHealthByModel(),
+	})
+}
+
+// backendHealthByModel 按模型返回各后端的健康状态与探测延迟
+func (h *ProxyHandler) backendHealthByModel() map[string][]loadbalancer.BackendHealth {
+	models := make(map[string][]loadbalancer.BackendHealth)
+	for model := range h.lb.ModelConfigs() {
+		if backends, ok := h.lb.BackendHealth(model); ok {
+			models[model] = backends
+		}
+	}
+	return models
+}
+
+// HandleStats 统计接口：返回按 API Key 及用量归属请求头汇总的请求数、token 用量和估算成本，以及当前正在处理的请求数
+func (h *ProxyHandler) HandleStats(c *gin.Context) {
+	collector := stats.GetInstance()
+	contentFilterModels, contentFilterKeys := collector.ContentFilter()
+	c.JSON(http.StatusOK, gin.H{
+		"started_at":  collector.StartedAt().Format(time.RFC3339),
+		"in_flight":   collector.InFlight(),
+		"keys":        collector.Keys(),
+		"attribution": collector.Attribution(),
+		// 按 key 统计的正在处理的请求数
+		"keys_in_flight": collector.KeyInFlight(),
+		// 按模型统计的 finish_reason 次数
+		"finish_reasons": collector.FinishReasons(),
+		// 按模型统计的流式响应首字节时间
+		"stream_ttfb": collector.StreamTTFB(),
+		// 按模型列出的后端健康状态与主动探测的基线延迟
+		"backends": h.backendHealthByModel(),
+		// 按模型和 key 统计的内容过滤命中类别次数
+		"content_filter": gin.H{
+			"models": contentFilterModels,
+			"keys":   contentFilterKeys,
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"azure-openai-proxy/azuread"
+	"azure-openai-proxy/config"
+)
+
+// tokenSource 返回凭据对应的 TokenSource，不存在时创建并启动后台刷新
+// 相同凭据的后端共享同一个 TokenSource；重载配置新增的凭据在首次使用时创建
+func (h *ProxyHandler) tokenSource(cfg config.AzureADConfig) *azuread.TokenSource {
+	key := azuread.Key(cfg)
+
+	h.tokensMu.Lock()
+	defer h.tokensMu.Unlock()
+	ts, ok := h.tokens[key]
+	if !ok {
+		ts = azuread.NewTokenSource(cfg, h.logger)
+		h.tokens[key] = ts
+	}
+	return ts
+}
+
+// setBackendAuth 设置后端认证头：OpenAI 后端以 api_key 作为 Bearer token；
+// Azure 后端配置了 azure_ad 时使用后台刷新的 Bearer token，否则使用 api-key
+func (h *ProxyHandler) setBackendAuth(ctx context.Context, header http.Header, backend config.Backend) error {
+	if backend.IsOpenAI() {
+		header.Del("api-key")
+		header.Del("x-api-key")
+		header.Set("Authorization", "Bearer "+backend.APIKey)
+		return nil
+	}
+	if backend.AzureAD == nil {
+		header.Set("api-key", backend.APIKey)
+		return nil
+	}
+
+	token, err := h.tokenSource(*backend.AzureAD).Token(ctx)
+	if err != nil {
+		return err
+	}
+	header.Del("api-key")
+	header.Set("Authorization", "Bearer "+token)
+	return nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"slices"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/loadbalancer"
+	"azure-openai-proxy/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKeyBackendTag 请求通过 model@tag 指定的后端标签
+const contextKeyBackendTag = "backend_tag"
+
+// hasTaggedBackend 检查模型是否配置了带有指定标签的后端
+func (h *ProxyHandler) hasTaggedBackend(model, tag string) bool {
+	modelCfg, _ := h.lb.ModelConfig(model)
+	for _, backend := range modelCfg.Backends {
+		if backend.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTierBackend 检查模型是否配置了服务该层级的后端
+func (h *ProxyHandler) hasTierBackend(model, tier string) bool {
+	modelCfg, _ := h.lb.ModelConfig(model)
+	for _, backend := range modelCfg.Backends {
+		if backend.ServesTier(tier) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyTier 返回请求所用 API key 的层级
+func (h *ProxyHandler) keyTier(c *gin.Context) string {
+	return h.cfg.KeyTier(c.GetString(middleware.ContextKeyAPIKeyName))
+}
+
+// pinnedBackends 返回 key 为模型固定的后端（auth.keys[].pins），未固定时返回 false
+func (h *ProxyHandler) pinnedBackends(c *gin.Context, model string) ([]config.Backend, bool) {
+	pin := h.cfg.KeyPin(c.GetString(middleware.ContextKeyAPIKeyName), model)
+	if pin == "" {
+		return nil, false
+	}
+	modelCfg, _ := h.lb.ModelConfig(model)
+	return modelCfg.PinnedBackends(pin), true
+}
+
+// 后端未参与本次选择的原因（backend selection 日志的 skipped 字段）
+const (
+	skipNotPinned = "not_pinned"
+	skipTier      = "tier"
+	skipTag       = "tag"
+	skipRouteTag  = "route_tag"
+	skipExcluded  = "excluded_by_request"
+)
+
+// backendsFor 按模型的负载均衡策略返回可用后端；只在服务该 key 层级的后端中选择，
+// 请求指定了标签（model@tag 或 body_routes）时只选择带有该标签的后端；
+// key 为模型固定了后端时只使用固定的后端，不受层级和标签限制
+func (h *ProxyHandler) backendsFor(c *gin.Context, model string) []*loadbalancer.BackendStatus {
+	if pinned, ok := h.pinnedBackends(c, model); ok {
+		filter := func(backend config.Backend) string {
+			if !slices.ContainsFunc(pinned, func(p config.Backend) bool {
+				return p.Endpoint == backend.Endpoint && p.Deployment == backend.Deployment
+			}) {
+				return skipNotPinned
+			}
+			return ""
+		}
+		return h.lb.GetBackendsMatching(model, h.hashKey(c), filter)
+	}
+
+	tag := c.GetString(contextKeyBackendTag)
+	routeTag := c.GetString(contextKeyRouteTag)
+	tier := h.keyTier(c)
+	filter := func(backend config.Backend) string {
+		switch {
+		case !backend.ServesTier(tier):
+			return skipTier
+		case tag != "" && !backend.HasTag(tag):
+			return skipTag
+		case routeTag != "" && !backend.HasTag(routeTag):
+			return skipRouteTag
+		}
+		return ""
+	}
+	return h.excludeBackends(c, model, filter)
+}
+
+// hashKey hash 策略的请求标识：优先使用 loadbalancer.hash_header，其次是 API key 名称，最后是客户端 IP
+func (h *ProxyHandler) hashKey(c *gin.Context) string {
+	if header := h.cfg.LoadBalancer.HashHeader; header != "" {
+		if value := c.GetHeader(header); value != "" {
+			return value
+		}
+	}
+	if name := c.GetString(middleware.ContextKeyAPIKeyName); name != "" {
+		return name
+	}
+	return c.ClientIP()
+}
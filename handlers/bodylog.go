@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"math/rand/v2"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// contextKeyBodySampled 标记当前请求被选中记录请求/响应体
+const contextKeyBodySampled = "body_sampled"
+
+// sampleBodyLog 按 logging.body_sample_rate 决定当前请求是否记录请求/响应体
+func (h *ProxyHandler) sampleBodyLog(c *gin.Context) {
+	if rate := h.cfg.Logging.BodySampleRate; rate > 0 && rand.Float64() < rate {
+		c.Set(contextKeyBodySampled, true)
+	}
+}
+
+// logBody 输出脱敏后的请求/响应体
+// 被采样的请求以 info 级别输出，其余请求仅在 debug 级别下输出；级别未启用时不做脱敏
+func (h *ProxyHandler) logBody(c *gin.Context, msg string, body []byte) {
+	level := zap.DebugLevel
+	if c.GetBool(contextKeyBodySampled) {
+		level = zap.InfoLevel
+	}
+	if ce := h.logger.Check(level, msg); ce != nil {
+		ce.Write(
+			zap.String("path", c.Request.URL.Path),
+			zap.String("body", string(redactJSON(body, h.redactFields))),
+		)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// contextKeyRouteTag 请求体字段路由（loadbalancer.body_routes）选出的后端标签
+const contextKeyRouteTag = "route_tag"
+
+// bodyRouteTag 按 loadbalancer.body_routes 的顺序匹配请求体字段，返回第一条命中规则的后端标签及字段路径
+// 字段取值忽略大小写匹配（配置中的 map key 会被转为小写）；字段不存在或不是字符串/数字/布尔值时跳过该规则
+func (h *ProxyHandler) bodyRouteTag(body []byte) (tag, field string) {
+	routes := h.cfg.LoadBalancer.BodyRoutes
+	if len(routes) == 0 {
+		return "", ""
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", ""
+	}
+	for _, route := range routes {
+		value, ok := lookupField(data, route.Field)
+		if !ok {
+			continue
+		}
+		if tag, ok := route.Values[strings.ToLower(value)]; ok {
+			return tag, route.Field
+		}
+	}
+	return "", ""
+}
+
+// lookupField 按 . 分隔的路径读取嵌套字段，返回标量值的字符串形式
+func lookupField(data map[string]interface{}, path string) (string, bool) {
+	parts := strings.Split(path, ".")
+	var current interface{} = data
+	for _, part := range parts {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if current, ok = obj[part]; !ok {
+			return "", false
+		}
+	}
+	switch v := current.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
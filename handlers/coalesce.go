@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"azure-openai-proxy/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// coalescer 合并相同的进行中非流式请求（coalescing 配置）：同一时刻只有第一个请求（leader）转发到后端，
+// 其余相同请求等待并复用其响应
+type coalescer struct {
+	shareAcrossKeys bool
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall 一次进行中的转发，done 关闭后其余字段只读
+type coalescedCall struct {
+	done    chan struct{}
+	ok      bool // leader 被取消或未写出响应时为 false，等待的请求各自转发
+	status  int
+	header  http.Header
+	body    []byte
+	waiters int
+}
+
+func newCoalescer(shareAcrossKeys bool) *coalescer {
+	return &coalescer{
+		shareAcrossKeys: shareAcrossKeys,
+		calls:           make(map[string]*coalescedCall),
+	}
+}
+
+// key 由 API 类型、模型和转发的请求体计算；未开启 share_across_keys 时包含 key 名称，保证用量按 key 归属
+func (co *coalescer) key(c *gin.Context, apiType, model string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(apiType + "\x00" + model + "\x00"))
+	if !co.shareAcrossKeys {
+		hash.Write([]byte(c.GetString(middleware.ContextKeyAPIKeyName) + "\x00"))
+	}
+	// 响应可能按客户端的 Accept-Encoding 压缩，接受与不接受 gzip 的请求不能共享响应
+	if acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		hash.Write([]byte("gzip\x00"))
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// coalesceRequest 相同请求正在转发时等待并复用其响应，否则作为 leader 调用 forward 并记录响应
+func (h *ProxyHandler) coalesceRequest(c *gin.Context, apiType, model string, body []byte, forward func()) {
+	co := h.coalescer
+	key := co.key(c, apiType, model, body)
+
+	co.mu.Lock()
+	if call, ok := co.calls[key]; ok {
+		call.waiters++
+		co.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-c.Request.Context().Done():
+			h.logger.Info("request cancelled by client while waiting for coalesced request")
+			return
+		}
+		if call.ok {
+			h.logger.Info("request coalesced with identical in-flight request",
+				zap.String("model", model),
+				zap.Int("status", call.status),
+			)
+			for k, values := range call.header {
+				for _, v := range values {
+					c.Writer.Header().Add(k, v)
+				}
+			}
+			c.Data(call.status, call.header.Get("Content-Type"), call.body)
+			return
+		}
+		// leader 没有得到可复用的响应，自行转发
+		forward()
+		return
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	co.calls[key] = call
+	co.mu.Unlock()
+
+	writer := &teeResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	defer func() {
+		c.Writer = writer.ResponseWriter
+
+		co.mu.Lock()
+		delete(co.calls, key)
+		waiters := call.waiters
+		co.mu.Unlock()
+
+		call.ok = c.Writer.Written() && c.Request.Context().Err() == nil
+		call.status = c.Writer.Status()
+		call.header = c.Writer.Header().Clone()
+		call.body = writer.buf.Bytes()
+		close(call.done)
+
+		if waiters > 0 {
+			h.logger.Info("coalesced identical requests",
+				zap.String("model", model),
+				zap.Int("waiters", waiters),
+				zap.Bool("shared", call.ok),
+			)
+		}
+	}()
+	forward()
+}
+
+// teeResponseWriter 在写出响应的同时保留一份副本
+type teeResponseWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *teeResponseWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *teeResponseWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// contentSafety 转发前的内容审核：先匹配 deny_patterns，再调用审核服务
+type contentSafety struct {
+	cfg      config.ContentSafetyConfig
+	patterns []*regexp.Regexp
+	client   *http.Client
+}
+
+func newContentSafety(cfg config.ContentSafetyConfig) *contentSafety {
+	patterns := make([]*regexp.Regexp, 0, len(cfg.DenyPatterns))
+	for _, p := range cfg.DenyPatterns {
+		// 已在配置校验中确认可以编译
+		patterns = append(patterns, regexp.MustCompile(p))
+	}
+	return &contentSafety{
+		cfg:      cfg,
+		patterns: patterns,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// check 检查请求中的文本，返回是否被拦截及原因
+func (s *contentSafety) check(ctx context.Context, apiType, model, text string) (bool, string, error) {
+	for _, p := range s.patterns {
+		if p.MatchString(text) {
+			return true, "matched deny pattern " + p.String(), nil
+		}
+	}
+	if s.cfg.Endpoint == "" {
+		return false, "", nil
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"api_type": apiType,
+		"model":    model,
+		"text":     text,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, "", fmt.Errorf("content safety endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Flagged bool   `json:"flagged"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, "", fmt.Errorf("invalid content safety response: %w", err)
+	}
+	return result.Flagged, result.Reason, nil
+}
+
+// checkContentSafety 对请求执行内容审核，请求被拦截或无法审核时写入响应并返回 false
+// 标记了 skip_content_safety 的 key 跳过审核
+func (h *ProxyHandler) checkContentSafety(c *gin.Context, apiType, model string, body []byte) bool {
+	if h.contentSafety == nil {
+		return true
+	}
+	keyName := c.GetString(middleware.ContextKeyAPIKeyName)
+	if h.cfg.SkipsContentSafety(keyName) {
+		h.logger.Debug("content safety skipped", zap.String("key_name", keyName))
+		return true
+	}
+
+	text := extractPromptText(body)
+	if text == "" {
+		return true
+	}
+
+	flagged, reason, err := h.contentSafety.check(c.Request.Context(), apiType, model, text)
+	if err != nil {
+		if h.cfg.ContentSafety.FailOpen {
+			h.logger.Warn("content safety check failed, allowing request",
+				zap.String("model", model),
+				zap.String("key_name", keyName),
+				zap.Error(err),
+			)
+			return true
+		}
+		h.logger.Error("content safety check failed, rejecting request",
+			zap.String("model", model),
+			zap.String("key_name", keyName),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "content safety check unavailable",
+			"detail": err.Error(),
+		})
+		return false
+	}
+
+	if !flagged {
+		h.logger.Info("content safety check passed",
+			zap.String("model", model),
+			zap.String("key_name", keyName),
+		)
+		return true
+	}
+	h.logger.Warn("request blocked by content safety",
+		zap.String("model", model),
+		zap.String("key_name", keyName),
+		zap.String("reason", reason),
+	)
+	invalidRequest(c, "", "content_filter",
+		"The request was rejected by the content safety policy.")
+	return false
+}
+
+// promptTextFields 参与内容审核的顶层请求字段（chat messages、responses input/instructions、embeddings input 等），按顺序提取
+var promptTextFields = []string{"instructions", "messages", "prompt", "input"}
+
+// nestedTextFields 消息与内容片段中参与审核的字段
+var nestedTextFields = map[string]bool{
+	"content": true,
+	"text":    true,
+}
+
+// extractPromptText 提取请求中需要审核的文本，多段文本以换行连接
+func extractPromptText(body []byte) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ""
+	}
+	var parts []string
+	for _, key := range promptTextFields {
+		collectText(data[key], &parts)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// collectText 递归收集字符串，对象中只进入 content/text 字段（跳过 role、image_url 等）
+func collectText(value interface{}, parts *[]string) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			*parts = append(*parts, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectText(item, parts)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if nestedTextFields[key] {
+				collectText(item, parts)
+			}
+		}
+	}
+}
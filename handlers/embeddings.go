@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"azure-openai-proxy/loadbalancer"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// embeddingsChunk 拆分后的一个分片
+type embeddingsChunk struct {
+	offset int // 分片第一个 input 在原数组中的下标
+	size   int // 分片的 input 数量
+	body   []byte
+}
+
+// chunkError 分片被后端以 4xx 拒绝，原样返回给客户端
+type chunkError struct {
+	status int
+	body   []byte
+}
+
+func (e *chunkError) Error() string {
+	return fmt.Sprintf("backend returned status %d", e.status)
+}
+
+// splitEmbeddingsInput 将 input 数组按 batchSize 拆分为多个请求体
+// input 不是数组或长度不超过 batchSize 时返回 false
+func splitEmbeddingsInput(body []byte, batchSize int) ([]embeddingsChunk, bool) {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, false
+	}
+	var inputs []json.RawMessage
+	if err := json.Unmarshal(data["input"], &inputs); err != nil || len(inputs) <= batchSize {
+		return nil, false
+	}
+
+	var chunks []embeddingsChunk
+	for offset := 0; offset < len(inputs); offset += batchSize {
+		end := min(offset+batchSize, len(inputs))
+		input, err := json.Marshal(inputs[offset:end])
+		if err != nil {
+			return nil, false
+		}
+		data["input"] = input
+		chunkBody, err := json.Marshal(data)
+		if err != nil {
+			return nil, false
+		}
+		chunks = append(chunks, embeddingsChunk{offset: offset, size: end - offset, body: chunkBody})
+	}
+	return chunks, true
+}
+
+// proxySplitEmbeddings 将分片并发转发到多个健康后端，按原始下标重组 data 并合并 usage
+// 分片失败时在其他后端上重试该分片，重试耗尽时整个请求失败
+func (h *ProxyHandler) proxySplitEmbeddings(c *gin.Context, model string, body []byte, chunks []embeddingsChunk) {
+	backends := h.backendsFor(c, model)
+	if len(backends) == 0 {
+		h.proxyWithModel(c, model, body, "embeddings", false)
+		return
+	}
+
+	h.logger.Info("splitting embeddings request",
+		zap.String("model", model),
+		zap.Int("chunks", len(chunks)),
+		zap.Int("backends", len(backends)),
+	)
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	responses := make([][]byte, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, h.cfg.Embeddings.MaxConcurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk embeddingsChunk) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// 分片 i 从第 i 个后端开始尝试，使分片均匀分布到各后端
+			responses[i], errs[i] = h.forwardEmbeddingsChunk(ctx, c, model, backends, i, chunk)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	// 优先返回后端的 4xx 响应，其次是第一个非取消导致的错误
+	var firstErr error
+	for _, err := range errs {
+		var chunkErr *chunkError
+		if errors.As(err, &chunkErr) {
+			c.Data(chunkErr.status, "application/json", chunkErr.body)
+			return
+		}
+		if err != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		if c.Request.Context().Err() != nil {
+			h.logger.Info("request cancelled by client")
+			return
+		}
+		h.logger.Error("embeddings chunk failed", zap.String("model", model), zap.Error(firstErr))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "all backends failed",
+			"detail": firstErr.Error(),
+		})
+		return
+	}
+
+	merged, u, err := mergeEmbeddingsResponses(responses, chunks)
+	if err != nil {
+		h.logger.Error("failed to merge embeddings responses", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "invalid backend response", "detail": err.Error()})
+		return
+	}
+
+	h.recordUsage(c, model, nil, u, true)
+	h.logBody(c, "response body", merged)
+	c.Data(http.StatusOK, "application/json", merged)
+}
+
+// forwardEmbeddingsChunk 转发单个分片，失败（包括返回的 data 与分片的 input 不对应）时按顺序尝试后续后端
+func (h *ProxyHandler) forwardEmbeddingsChunk(ctx context.Context, c *gin.Context, model string, backends []*loadbalancer.BackendStatus, start int, chunk embeddingsChunk) ([]byte, error) {
+	body := chunk.body
+	maxAttempts := h.cfg.Retry.TotalAttempts(len(backends))
+
+	lastErr := errors.New("no backend attempted")
+	begin := time.Now()
+	release := func() {}
+	defer func() { release() }()
+	for i := 0; i < maxAttempts; i++ {
+		if i > 0 {
+			if err := h.waitRetry(ctx, begin, i); errors.Is(err, errRetryBudgetExhausted) {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		backendIndex := h.cfg.Retry.BackendIndex(i)
+		backend := backends[(start+backendIndex)%len(backends)]
+		release()
+		next, ok := h.lb.BeginRequest(backend)
+		if !ok {
+			lastErr = fmt.Errorf("backend concurrency limit reached")
+			for i+1 < maxAttempts && h.cfg.Retry.BackendIndex(i+1) == backendIndex {
+				i++
+			}
+			continue
+		}
+		if !h.lb.AcquireRequest(backend) {
+			next()
+			lastErr = fmt.Errorf("backend rate limited")
+			for i+1 < maxAttempts && h.cfg.Retry.BackendIndex(i+1) == backendIndex {
+				i++
+			}
+			continue
+		}
+		release = next
+
+		reqBody := backendRequestBody(backend.Backend, body)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamURL(backend.Backend, "embeddings", backendAPIVersion(backend.Backend), h.urlTemplate(model, "embeddings")), bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		h.copyRequestHeaders(req.Header, c.Request.Header)
+		if err := h.setBackendAuth(ctx, req.Header, backend.Backend); err != nil {
+			h.lb.MarkUnhealthy(model, backend)
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = int64(len(reqBody))
+
+		client, err := h.backendClient(h.clientFor("embeddings"), backend.Backend)
+		if err != nil {
+			h.lb.MarkUnhealthy(model, backend)
+			lastErr = err
+			continue
+		}
+		attemptStart := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			h.logger.Warn("embeddings chunk request failed",
+				zap.String("endpoint", backend.MaskedEndpoint()),
+				zap.Error(err),
+			)
+			h.lb.MarkUnhealthy(model, backend)
+			lastErr = err
+			continue
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil && h.cfg.Retry.ValidateResponse && resp.StatusCode == http.StatusOK {
+			err = validateResponseBody("embeddings", respBody)
+		}
+		if err == nil && resp.StatusCode == http.StatusOK {
+			err = checkEmbeddingsChunk(respBody, chunk.size)
+		}
+		if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+			if err == nil {
+				err = fmt.Errorf("backend returned status %d", resp.StatusCode)
+			}
+			h.logger.Warn("embeddings chunk failed",
+				zap.String("endpoint", backend.MaskedEndpoint()),
+				zap.Error(err),
+			)
+			h.lb.MarkUnhealthy(model, backend)
+			lastErr = err
+			continue
+		}
+
+		h.lb.MarkHealthy(model, backend)
+		h.lb.RecordLatency(backend, time.Since(attemptStart))
+		if resp.StatusCode >= http.StatusMultipleChoices {
+			return nil, &chunkError{status: resp.StatusCode, body: respBody}
+		}
+		if u, ok := parseUsage(respBody); ok {
+			h.lb.RecordUsage(backend, u.TotalTokens)
+		}
+		return respBody, nil
+	}
+	return nil, lastErr
+}
+
+// checkEmbeddingsChunk 检查分片响应的 data 恰好包含下标 0..size-1 各一项，避免重组时缺项或错位
+func checkEmbeddingsChunk(body []byte, size int) error {
+	var resp struct {
+		Data []struct {
+			Index *int `json:"index"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("invalid response body: %w", err)
+	}
+	if len(resp.Data) != size {
+		return fmt.Errorf("incomplete embeddings response: got %d items, want %d", len(resp.Data), size)
+	}
+	seen := make([]bool, size)
+	for _, item := range resp.Data {
+		if item.Index == nil || *item.Index < 0 || *item.Index >= size || seen[*item.Index] {
+			return fmt.Errorf("incomplete embeddings response: missing or duplicate index")
+		}
+		seen[*item.Index] = true
+	}
+	return nil
+}
+
+// mergeEmbeddingsResponses 以第一个分片的响应为模板，按原始下标合并 data 并累加 usage
+func mergeEmbeddingsResponses(responses [][]byte, chunks []embeddingsChunk) ([]byte, usage, error) {
+	type indexedItem struct {
+		index int
+		item  map[string]json.RawMessage
+	}
+
+	var merged map[string]json.RawMessage
+	var items []indexedItem
+	var total usage
+
+	for i, respBody := range responses {
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(respBody, &resp); err != nil {
+			return nil, usage{}, err
+		}
+		if merged == nil {
+			merged = resp
+		}
+
+		var data []map[string]json.RawMessage
+		if err := json.Unmarshal(resp["data"], &data); err != nil {
+			return nil, usage{}, fmt.Errorf("chunk %d: invalid data: %w", i, err)
+		}
+		for _, item := range data {
+			var index int
+			if err := json.Unmarshal(item["index"], &index); err != nil {
+				return nil, usage{}, fmt.Errorf("chunk %d: invalid index: %w", i, err)
+			}
+			index += chunks[i].offset
+			item["index"] = json.RawMessage(strconv.Itoa(index))
+			items = append(items, indexedItem{index: index, item: item})
+		}
+
+		if u, ok := parseUsage(respBody); ok {
+			total.PromptTokens += u.PromptTokens
+			total.TotalTokens += u.TotalTokens
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].index < items[j].index
+	})
+	data := make([]map[string]json.RawMessage, len(items))
+	for i, item := range items {
+		data[i] = item.item
+	}
+
+	var err error
+	if merged["data"], err = json.Marshal(data); err != nil {
+		return nil, usage{}, err
+	}
+	if merged["usage"], err = json.Marshal(map[string]int{
+		"prompt_tokens": total.PromptTokens,
+		"total_tokens":  total.TotalTokens,
+	}); err != nil {
+		return nil, usage{}, err
+	}
+	body, err := json.Marshal(merged)
+	return body, total, err
+}
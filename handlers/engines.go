@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// contextKeyEngine 旧版 engines 路径中的引擎名称，handleOpenAIRequest 以它作为请求的模型
+const contextKeyEngine = "engine"
+
+// engineDeprecationWarning 旧版 engines 路径的弃用提示，通过 Warning 响应头返回
+const engineDeprecationWarning = `299 - "The /v1/engines endpoints are deprecated; specify the model in the request body instead"`
+
+// HandleEngine 返回旧版 /v1/engines/{engine}/{apiType} 路由的处理函数：
+// 引擎名称作为模型（与请求体中的 model 同样解析，支持大小写不敏感、model@tag 与 catch_all），
+// 其余流程与 /v1/{apiType} 相同，响应附带 Deprecation 与 Warning 头提示客户端迁移
+func (h *ProxyHandler) HandleEngine(apiType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		engine := c.Param("engine")
+		h.logger.Warn("legacy engines route used",
+			zap.String("engine", engine),
+			zap.String("api_type", apiType),
+		)
+		c.Header("Deprecation", "true")
+		c.Header("Warning", engineDeprecationWarning)
+		c.Set(contextKeyEngine, engine)
+		h.handleOpenAIRequest(c, apiType)
+	}
+}
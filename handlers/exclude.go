@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"strings"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/loadbalancer"
+	"azure-openai-proxy/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// headerExcludeEndpoint 客户端指定本次请求不使用的后端端点，多个以逗号分隔
+// 可以是完整的 endpoint，也可以是 X-Upstream-Endpoint 返回的遮蔽后的地址
+const headerExcludeEndpoint = "X-Exclude-Endpoint"
+
+// excludedEndpoints 返回请求通过 X-Exclude-Endpoint 排除的端点，按 loadbalancer.exclude_header 判断是否生效
+func (h *ProxyHandler) excludedEndpoints(c *gin.Context) []string {
+	value := c.GetHeader(headerExcludeEndpoint)
+	if value == "" {
+		return nil
+	}
+	keyName := c.GetString(middleware.ContextKeyAPIKeyName)
+	switch h.cfg.LoadBalancer.ExcludeHeader {
+	case "all":
+	case "admin":
+		if !h.cfg.IsAdminKey(keyName) {
+			h.logger.Warn("ignoring X-Exclude-Endpoint from non-admin key", zap.String("key_name", keyName))
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	var endpoints []string
+	for _, endpoint := range strings.Split(value, ",") {
+		if endpoint = normalizeEndpoint(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+func normalizeEndpoint(endpoint string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(endpoint), "/"))
+}
+
+// excludeBackends 在 filter 的基础上排除请求指定的端点后选择后端，只影响本次请求，不改变后端的健康状态
+// 全部候选都被排除时忽略排除条件，避免请求因此无后端可用
+func (h *ProxyHandler) excludeBackends(c *gin.Context, model string, filter loadbalancer.BackendFilter) []*loadbalancer.BackendStatus {
+	excluded := h.excludedEndpoints(c)
+	if len(excluded) == 0 {
+		return h.lb.GetBackendsMatching(model, h.hashKey(c), filter)
+	}
+
+	backends := h.lb.GetBackendsMatching(model, h.hashKey(c), func(backend config.Backend) string {
+		if reason := filter(backend); reason != "" {
+			return reason
+		}
+		if endpointExcluded(backend, excluded) {
+			return skipExcluded
+		}
+		return ""
+	})
+	if len(backends) == 0 {
+		h.logger.Warn("all candidate backends excluded by request, ignoring X-Exclude-Endpoint",
+			zap.Strings("excluded", excluded),
+		)
+		return h.lb.GetBackendsMatching(model, h.hashKey(c), filter)
+	}
+	h.logger.Info("backends excluded by request",
+		zap.Strings("excluded", excluded),
+		zap.Int("remaining", len(backends)),
+	)
+	return backends
+}
+
+func endpointExcluded(backend config.Backend, excluded []string) bool {
+	endpoint := normalizeEndpoint(backend.Endpoint)
+	masked := normalizeEndpoint(loadbalancer.MaskEndpoint(backend.Endpoint))
+	for _, e := range excluded {
+		if e == endpoint || e == masked {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"azure-openai-proxy/loadbalancer"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// attemptRecord 一次后端尝试的结果
+type attemptRecord struct {
+	endpoint   string
+	deployment string
+	apiVersion string
+	status     int // 未收到响应时为 0
+	err        string
+	latency    time.Duration
+}
+
+func (a attemptRecord) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("endpoint", a.endpoint)
+	enc.AddString("deployment", a.deployment)
+	if a.apiVersion != "" {
+		enc.AddString("api_version", a.apiVersion)
+	}
+	if a.status != 0 {
+		enc.AddInt("status", a.status)
+	}
+	if a.err != "" {
+		enc.AddString("error", a.err)
+	}
+	enc.AddDuration("latency", a.latency)
+	return nil
+}
+
+// attemptChain 一个请求依次尝试各后端的结果，即故障转移链
+type attemptChain []attemptRecord
+
+func (ch attemptChain) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, a := range ch {
+		if err := enc.AppendObject(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add 记录一次尝试，start 为该次尝试开始的时间
+func (ch *attemptChain) add(backend *loadbalancer.BackendStatus, apiVersion string, status int, err error, start time.Time) {
+	a := attemptRecord{
+		endpoint:   backend.MaskedEndpoint(),
+		deployment: backend.Backend.Deployment,
+		apiVersion: apiVersion,
+		status:     status,
+		latency:    time.Since(start),
+	}
+	if err != nil {
+		a.err = err.Error()
+	}
+	*ch = append(*ch, a)
+}
+
+// logAttemptChain 请求结束时输出一条汇总日志，描述完整的故障转移链及最终结果
+// 只尝试了一次且成功的请求已有常规日志，不再重复输出
+func (h *ProxyHandler) logAttemptChain(c *gin.Context, model string, chain attemptChain, start time.Time) {
+	status := c.Writer.Status()
+	failed := status >= http.StatusInternalServerError
+	if len(chain) == 0 || (len(chain) == 1 && !failed) {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("model", model),
+		zap.Int("attempts", len(chain)),
+		zap.Array("chain", chain),
+		zap.Int("final_status", status),
+		zap.Duration("elapsed", time.Since(start)),
+	}
+	if c.Request.Context().Err() != nil {
+		fields = append(fields, zap.Bool("client_cancelled", true))
+	}
+	if failed {
+		h.logger.Warn("failover chain", fields...)
+		return
+	}
+	h.logger.Info("failover chain", fields...)
+}
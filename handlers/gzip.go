@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// errBodyTooLarge 解压后的请求体超出 maxBodySize
+var errBodyTooLarge = errors.New("request body too large")
+
+// decodeRequestBody 按 Content-Encoding 解压请求体，解压后的大小同样受 maxBodySize 限制
+// 未压缩时原样返回；不支持的编码返回错误
+func decodeRequestBody(body []byte, encoding string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	if int64(len(decoded)) >= maxBodySize {
+		return nil, errBodyTooLarge
+	}
+	return decoded, nil
+}
+
+// acceptsGzip 检查客户端的 Accept-Encoding 是否接受 gzip（q=0 表示明确拒绝）
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, "gzip") && coding != "*" {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressResponse 开启 server.response_compression 时，客户端接受 gzip 且后端返回了未压缩、
+// 达到 min_size_kb 的响应体时返回压缩后的响应体；不满足条件或压缩失败时返回 false
+func (h *ProxyHandler) compressResponse(c *gin.Context, resp *http.Response, body []byte) ([]byte, bool) {
+	cfg := h.cfg.Server.ResponseCompression
+	if !cfg.Enabled || len(body) < cfg.MinSizeKB*1024 {
+		return nil, false
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return nil, false
+	}
+	if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		return nil, false
+	}
+	compressed, err := gzipBody(body)
+	if err != nil {
+		h.logger.Warn("failed to compress response", zap.Error(err))
+		return nil, false
+	}
+	return compressed, true
+}
+
+// gzipBody 压缩转发给后端的请求体，也用于压缩返回给客户端的响应体
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"azure-openai-proxy/config"
+
+	"go.uber.org/zap"
+)
+
+// imageURLTransformer 改写 chat 消息中 image_url 的远程地址（images 配置）：
+// 经 proxy_prefix 指向内部代理/缓存，或由代理下载后内联为 base64 data URL
+type imageURLTransformer struct {
+	cfg       config.ImagesConfig
+	prefix    string
+	inline    bool
+	maxBytes  int64
+	maxImages int
+	client    *http.Client
+	logger    *zap.Logger
+}
+
+func newImageURLTransformer(cfg *config.Config, logger *zap.Logger) (RequestTransformer, error) {
+	images := cfg.Images
+	if images.ProxyPrefix == "" && !images.Inline {
+		return nil, errors.New("images.proxy_prefix or images.inline must be set")
+	}
+	// 经 proxy_prefix 下载时目标是运维配置的内部代理，使用普通 client；
+	// 直接下载客户端提供的地址时只允许连接公网地址，重定向同样受 allowed_hosts 限制
+	client := &http.Client{Timeout: images.FetchTimeout}
+	if images.ProxyPrefix == "" {
+		client.Transport = newPublicOnlyTransport()
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !images.HostAllowed(req.URL.Hostname()) {
+				return fmt.Errorf("redirect to host %q is not allowed", req.URL.Hostname())
+			}
+			return nil
+		}
+	}
+	return &imageURLTransformer{
+		cfg:       images,
+		prefix:    images.ProxyPrefix,
+		inline:    images.Inline,
+		maxBytes:  int64(images.MaxSizeMB) * 1024 * 1024,
+		maxImages: images.MaxImages,
+		client:    client,
+		logger:    logger,
+	}, nil
+}
+
+// newPublicOnlyTransport 只连接公网地址的 transport：在建立连接时检查解析后的 IP，
+// 拒绝回环、私有、链路本地（包括云厂商元数据地址 169.254.169.254）等地址，DNS 重绑定同样无法绕过；
+// 不使用环境变量中的 HTTP 代理，否则检查的是代理地址而不是图片服务器
+func newPublicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("connection to non-public address %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// publicIP 检查 IP 是否为可从公网访问的单播地址
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+func (t *imageURLTransformer) Transform(apiType string, body []byte) ([]byte, error) {
+	return t.TransformContext(context.Background(), apiType, body)
+}
+
+// TransformContext 实现 ContextTransformer，客户端断开时停止下载剩余的图片
+func (t *imageURLTransformer) TransformContext(ctx context.Context, apiType string, body []byte) ([]byte, error) {
+	if apiType != "chat/completions" {
+		return body, nil
+	}
+
+	var rewriteErr error
+	inlined := 0
+	newBody, err := transformJSONObject(body, func(data map[string]interface{}) bool {
+		messages, _ := data["messages"].([]interface{})
+		modified := false
+		for _, m := range messages {
+			msg, _ := m.(map[string]interface{})
+			parts, _ := msg["content"].([]interface{})
+			for _, p := range parts {
+				part, _ := p.(map[string]interface{})
+				if part["type"] != "image_url" {
+					continue
+				}
+				image, _ := part["image_url"].(map[string]interface{})
+				rawURL, _ := image["url"].(string)
+				if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+					continue
+				}
+
+				newURL, err := t.rewrite(ctx, rawURL, &inlined)
+				if err != nil {
+					rewriteErr = err
+					return false
+				}
+				image["url"] = newURL
+				modified = true
+			}
+		}
+		return modified
+	})
+	if rewriteErr != nil {
+		return nil, rewriteErr
+	}
+	return newBody, err
+}
+
+// rewrite 返回改写后的图片地址，inlined 为本请求已内联的图片数
+func (t *imageURLTransformer) rewrite(ctx context.Context, rawURL string, inlined *int) (string, error) {
+	fetchURL := rawURL
+	if t.prefix != "" {
+		fetchURL = t.prefix + url.QueryEscape(rawURL)
+	}
+	if !t.inline {
+		return fetchURL, nil
+	}
+
+	// 只下载 http(s) 地址，且域名须在 allowed_hosts 中
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return "", &RequestError{
+			Param:   "messages",
+			Code:    "invalid_image_url",
+			Message: "Image URL must be an absolute http or https URL.",
+		}
+	}
+	if !t.cfg.HostAllowed(parsed.Hostname()) {
+		t.logger.Warn("image host not allowed", zap.String("host", parsed.Hostname()))
+		return "", &RequestError{
+			Param:   "messages",
+			Code:    "image_url_not_allowed",
+			Message: fmt.Sprintf("Downloading images from %s is not allowed.", parsed.Hostname()),
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if *inlined >= t.maxImages {
+		return "", &RequestError{
+			Param:   "messages",
+			Code:    "too_many_images",
+			Message: fmt.Sprintf("Too many remote images in request, at most %d are allowed.", t.maxImages),
+		}
+	}
+	*inlined++
+
+	data, contentType, err := t.fetch(ctx, fetchURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		t.logger.Warn("failed to inline image", zap.String("url", rawURL), zap.Error(err))
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) {
+			return "", reqErr
+		}
+		return "", &RequestError{
+			Param:   "messages",
+			Code:    "invalid_image_url",
+			Message: fmt.Sprintf("Failed to download image from %s.", rawURL),
+		}
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// fetch 下载图片，超出大小上限或不是图片时返回 RequestError
+func (t *imageURLTransformer) fetch(ctx context.Context, fetchURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("image server returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > t.maxBytes {
+		return nil, "", t.tooLarge()
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, t.maxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > t.maxBytes {
+		return nil, "", t.tooLarge()
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("unexpected content type %q", contentType)
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return data, contentType, nil
+}
+
+func (t *imageURLTransformer) tooLarge() *RequestError {
+	return &RequestError{
+		Param:   "messages",
+		Code:    "image_too_large",
+		Message: fmt.Sprintf("Image exceeds the maximum size of %d MB.", t.maxBytes/1024/1024),
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	"azure-openai-proxy/config"
+
+	"go.uber.org/zap"
+)
+
+// mirrorRecord 镜像文件中的一条记录（JSON Lines 格式）
+type mirrorRecord struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	APIType   string          `json:"api_type"`
+	Model     string          `json:"model"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	BodyRaw   string          `json:"body_raw,omitempty"` // 请求体不是合法 JSON 时原样保存
+}
+
+// requestMirror 按采样率将请求体异步写入按大小滚动的本地文件，用于回放
+// 写入在后台协程完成，缓冲区满时直接丢弃，不阻塞请求
+type requestMirror struct {
+	cfg          config.MirrorConfig
+	redactFields map[string]struct{}
+	logger       *zap.Logger
+	records      chan mirrorRecord
+
+	file *os.File
+	size int64
+}
+
+func newRequestMirror(cfg config.MirrorConfig, redactFields []string, logger *zap.Logger) (*requestMirror, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("create mirror directory: %w", err)
+	}
+
+	m := &requestMirror{
+		cfg:          cfg,
+		redactFields: redactFieldSet(redactFields),
+		logger:       logger,
+		records:      make(chan mirrorRecord, cfg.BufferSize),
+	}
+	if err := m.open(); err != nil {
+		return nil, err
+	}
+
+	go m.run()
+	return m, nil
+}
+
+// record 按采样率投递一条请求记录
+func (m *requestMirror) record(method, path, apiType, model string, body []byte) {
+	if m == nil || rand.Float64() >= m.cfg.SampleRate {
+		return
+	}
+
+	select {
+	case m.records <- mirrorRecord{
+		Timestamp: time.Now(),
+		Method:    method,
+		Path:      path,
+		APIType:   apiType,
+		Model:     model,
+		Body:      body,
+	}:
+	default:
+		m.logger.Debug("mirror buffer full, dropping record")
+	}
+}
+
+func (m *requestMirror) run() {
+	for rec := range m.records {
+		// 脱敏在后台协程完成，避免增加请求路径的开销
+		if json.Valid(rec.Body) {
+			rec.Body = redactJSON(rec.Body, m.redactFields)
+		} else {
+			rec.BodyRaw = string(rec.Body)
+			rec.Body = nil
+		}
+
+		line, err := json.Marshal(rec)
+		if err != nil {
+			m.logger.Warn("failed to marshal mirror record", zap.Error(err))
+			continue
+		}
+		line = append(line, '\n')
+
+		if err := m.write(line); err != nil {
+			m.logger.Warn("failed to write mirror record", zap.Error(err))
+		}
+	}
+}
+
+func (m *requestMirror) write(line []byte) error {
+	maxSize := int64(m.cfg.MaxSizeMB) * 1024 * 1024
+	if m.size > 0 && m.size+int64(len(line)) > maxSize {
+		if err := m.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := m.file.Write(line)
+	m.size += int64(n)
+	return err
+}
+
+func (m *requestMirror) open() error {
+	file, err := os.OpenFile(m.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open mirror file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat mirror file: %w", err)
+	}
+	m.file = file
+	m.size = info.Size()
+	return nil
+}
+
+// rotate 滚动文件：path -> path.1 -> path.2 ...，超出 max_backups 的旧文件被删除
+func (m *requestMirror) rotate() error {
+	m.file.Close()
+
+	os.Remove(fmt.Sprintf("%s.%d", m.cfg.Path, m.cfg.MaxBackups))
+	for i := m.cfg.MaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", m.cfg.Path, i), fmt.Sprintf("%s.%d", m.cfg.Path, i+1))
+	}
+	if m.cfg.MaxBackups > 0 {
+		if err := os.Rename(m.cfg.Path, m.cfg.Path+".1"); err != nil {
+			return fmt.Errorf("rotate mirror file: %w", err)
+		}
+	} else if err := os.Remove(m.cfg.Path); err != nil {
+		return fmt.Errorf("rotate mirror file: %w", err)
+	}
+
+	return m.open()
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"azure-openai-proxy/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelOwner /v1/models 响应中模型的 owned_by
+const modelOwner = "azure-openai-proxy"
+
+// HandleModels 模型列表接口，兼容 OpenAI 的 GET /v1/models
+// 只列出已启用且有服务该 key 层级后端的模型；管理员 key 的响应中每个模型额外包含 backends（各后端的健康状态与失败次数）
+func (h *ProxyHandler) HandleModels(c *gin.Context) {
+	admin := h.cfg.IsAdminKey(c.GetString(middleware.ContextKeyAPIKeyName))
+	tier := h.keyTier(c)
+
+	models := make([]string, 0)
+	for model := range h.lb.ModelConfigs() {
+		if h.lb.ModelEnabled(model) && h.hasTierBackend(model, tier) {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+
+	data := make([]gin.H, 0, len(models))
+	for _, model := range models {
+		entry := gin.H{
+			"id":       model,
+			"object":   "model",
+			"created":  0,
+			"owned_by": modelOwner,
+		}
+		if admin {
+			if backends, ok := h.lb.BackendHealth(model); ok {
+				entry["backends"] = backends
+			}
+		}
+		data = append(data, entry)
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
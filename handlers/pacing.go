@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"azure-openai-proxy/config"
+)
+
+// streamPacer 限制流式响应转发给客户端的速率（server.stream_pacing）
+// 转发循环每次只读取一个缓冲区并同步写出，等待期间不再读取上游，数据留在上游连接中，代理不会无限缓冲
+type streamPacer struct {
+	bytesPerSec  float64
+	eventsPerSec float64
+	start        time.Time
+	bytes        int
+	events       int
+}
+
+// newStreamPacer 未配置速率限制时返回 nil
+func newStreamPacer(cfg config.StreamPacingConfig) *streamPacer {
+	if cfg.BytesPerSecond <= 0 && cfg.EventsPerSecond <= 0 {
+		return nil
+	}
+	return &streamPacer{
+		bytesPerSec:  float64(cfg.BytesPerSecond),
+		eventsPerSec: float64(cfg.EventsPerSecond),
+		start:        time.Now(),
+	}
+}
+
+// wait 记录已写出的数据，转发速度超出限制时等待，context 取消时返回 false
+func (p *streamPacer) wait(ctx context.Context, chunk []byte) bool {
+	if p == nil {
+		return true
+	}
+	p.bytes += len(chunk)
+	p.events += bytes.Count(chunk, []byte("\n\n"))
+
+	// 按已写出的总量计算应当经过的时间，取字节与事件两者中较长的一个
+	var due time.Duration
+	if p.bytesPerSec > 0 {
+		due = time.Duration(float64(p.bytes) / p.bytesPerSec * float64(time.Second))
+	}
+	if p.eventsPerSec > 0 {
+		due = max(due, time.Duration(float64(p.events)/p.eventsPerSec*float64(time.Second)))
+	}
+	delay := due - time.Since(p.start)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
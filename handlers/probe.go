@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/loadbalancer"
+
+	"go.uber.org/zap"
+)
+
+// Probe 实现 loadbalancer.HealthProber：主动探测后端是否可用，返回成功那次探测的往返时间
+// 单次探测失败（超时、网络错误或 5xx）后按指数退避重试，全部失败才判定不可用，避免短暂网络抖动导致后端持续下线
+func (h *ProxyHandler) Probe(backend config.Backend) (time.Duration, error) {
+	cfg := h.cfg.HealthCheck
+	endpoint := loadbalancer.MaskEndpoint(backend.Endpoint)
+	backoff := cfg.ProbeBackoff
+
+	// 没有进行任何探测时不能视为成功，否则未探测的后端会被恢复并记录为 0 延迟
+	err := fmt.Errorf("probe_attempts is %d, backend was not probed", cfg.ProbeAttempts)
+	for attempt := 1; attempt <= cfg.ProbeAttempts; attempt++ {
+		start := time.Now()
+		if err = h.probeOnce(backend); err == nil {
+			return time.Since(start), nil
+		}
+
+		h.logger.Debug("backend probe attempt failed",
+			zap.String("endpoint", endpoint),
+			zap.String("deployment", backend.Deployment),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+		if attempt < cfg.ProbeAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	h.logger.Warn("backend probe failed",
+		zap.String("endpoint", endpoint),
+		zap.String("deployment", backend.Deployment),
+		zap.Int("attempts", cfg.ProbeAttempts),
+		zap.Error(err),
+	)
+	return 0, err
+}
+
+func (h *ProxyHandler) probeOnce(backend config.Backend) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.HealthCheck.ProbeTimeout)
+	defer cancel()
+
+	status, err := h.pingBackend(ctx, backend)
+	if err != nil {
+		return err
+	}
+	if status >= http.StatusInternalServerError {
+		return fmt.Errorf("backend returned status %d", status)
+	}
+	return nil
+}
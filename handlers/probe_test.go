@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"azure-openai-proxy/config"
+)
+
+func TestProbeWithoutAttemptsFails(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer upstream.Close()
+
+	h := newTestProxyHandler(t, &config.Config{
+		HealthCheck: config.HealthCheckConfig{ProbeAttempts: 0, ProbeTimeout: time.Second},
+	})
+	latency, err := h.Probe(config.Backend{Endpoint: upstream.URL, APIKey: "test", Deployment: "gpt-4"})
+	if err == nil {
+		t.Fatal("Probe succeeded without probing the backend")
+	}
+	if latency != 0 || requests.Load() != 0 {
+		t.Errorf("latency = %v, requests = %d, want 0 and 0", latency, requests.Load())
+	}
+
+	h.cfg.HealthCheck.ProbeAttempts = 1
+	latency, err = h.Probe(config.Backend{Endpoint: upstream.URL, APIKey: "test", Deployment: "gpt-4"})
+	if err != nil || latency <= 0 || requests.Load() != 1 {
+		t.Errorf("Probe = (%v, %v) after %d requests, want positive latency after 1 request", latency, err, requests.Load())
+	}
+}
@@ -2,15 +2,26 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"azure-openai-proxy/azuread"
 	"azure-openai-proxy/config"
 	"azure-openai-proxy/loadbalancer"
+	"azure-openai-proxy/middleware"
+	"azure-openai-proxy/stats"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -19,76 +30,157 @@ import (
 const maxBodySize = 10 * 1024 * 1024 // 10MB
 
 type ProxyHandler struct {
-	lb     *loadbalancer.LoadBalancer
-	cfg    *config.Config
-	logger *zap.Logger
-	client *http.Client
+	lb         *loadbalancer.LoadBalancer
+	cfg        *config.Config
+	logger     *zap.Logger
+	client     *http.Client
+	transforms transformChain
+	mirror     *requestMirror // 未启用请求镜像时为 nil
+	// redactFields 输出请求/响应体日志时需要脱敏的字段
+	redactFields map[string]struct{}
+	// streamClient 与 client 共享连接池，但不设置整体超时
+	streamClient *http.Client
+	// apiClients 按 API 类型使用 retry.timeouts 作为整体超时的 client，共享连接池
+	apiClients map[string]*http.Client
+	// tokens 按凭据缓存的 Azure AD TokenSource
+	tokens   map[string]*azuread.TokenSource
+	tokensMu sync.Mutex
+	// responseOwners 记录 Responses API 的 response id 由哪个端点创建
+	responseOwners responseOwners
+	// coalescer 合并相同的进行中非流式请求，未启用 coalescing 时为 nil
+	coalescer *coalescer
+	// tlsTransports 按 TLS 配置缓存的后端 transport（配置了 tls 的后端使用）
+	tlsTransports map[string]*http.Transport
+	transportsMu  sync.Mutex
+	// contentSafety 转发前的内容审核，未配置 content_safety 时为 nil
+	contentSafety *contentSafety
 }
 
-func NewProxyHandler(lb *loadbalancer.LoadBalancer, cfg *config.Config, logger *zap.Logger) *ProxyHandler {
-	return &ProxyHandler{
+func NewProxyHandler(lb *loadbalancer.LoadBalancer, cfg *config.Config, logger *zap.Logger) (*ProxyHandler, error) {
+	transforms, err := newTransformChain(cfg.Transforms, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var mirror *requestMirror
+	if cfg.Mirror.Enabled {
+		if mirror, err = newRequestMirror(cfg.Mirror, cfg.Logging.RedactFields, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	// 流式请求等待响应头的超时按 API 类型在请求级别控制（doWithHeaderTimeout），transport 不设置 ResponseHeaderTimeout
+	transport := newTransport(cfg.Transport)
+	apiClients := make(map[string]*http.Client)
+	for _, apiType := range []string{"chat/completions", "embeddings", "responses"} {
+		apiClients[apiType] = &http.Client{
+			Timeout:   cfg.Retry.TimeoutFor(apiType),
+			Transport: transport,
+		}
+	}
+
+	h := &ProxyHandler{
 		lb:     lb,
 		cfg:    cfg,
 		logger: logger,
 		client: &http.Client{
-			Timeout: cfg.Retry.Timeout,
+			Timeout:   cfg.Retry.Timeout,
+			Transport: transport,
 		},
+		streamClient: &http.Client{
+			Transport: transport,
+		},
+		apiClients:    apiClients,
+		transforms:    transforms,
+		mirror:        mirror,
+		redactFields:  redactFieldSet(cfg.Logging.RedactFields),
+		tokens:        make(map[string]*azuread.TokenSource),
+		tlsTransports: make(map[string]*http.Transport),
 	}
+
+	if cfg.Coalescing.Enabled {
+		h.coalescer = newCoalescer(cfg.Coalescing.ShareAcrossKeys)
+	}
+	if cfg.ContentSafety.Enabled() {
+		h.contentSafety = newContentSafety(cfg.ContentSafety)
+	}
+
+	// 启动时即开始获取 Azure AD token，避免首个请求等待；同时创建 TLS transport，配置错误在启动时暴露
+	for _, modelCfg := range cfg.Models {
+		for _, backend := range modelCfg.Backends {
+			if backend.AzureAD != nil {
+				h.tokenSource(*backend.AzureAD)
+			}
+			if backend.TLS != nil {
+				if _, err := h.tlsTransport(backend); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return h, nil
 }
 
-// 从请求体中提取模型名称
-func extractModel(body []byte) string {
+// 从请求体中提取模型名称，返回去除首尾空白后的名称以及原始值
+func extractModel(body []byte) (model string, raw string) {
 	var req struct {
 		Model string `json:"model"`
 	}
 	if err := json.Unmarshal(body, &req); err != nil {
-		return ""
+		return "", ""
 	}
-	return req.Model
+	return strings.TrimSpace(req.Model), req.Model
 }
 
-// Azure OpenAI 不支持的参数列表
-var unsupportedParams = []string{
-	"chat_template_kwargs",
-	"enable_thinking",
-	"thinking",
+// isJSONObject 检查请求体是否为 JSON 对象
+func isJSONObject(body []byte) bool {
+	var data map[string]json.RawMessage
+	return json.Unmarshal(body, &data) == nil
 }
 
-// transformRequestBody 转换请求体中的参数
-// 1. 将 max_tokens 转换为 max_completion_tokens（新版 Azure OpenAI API 要求）
-// 2. 移除 Azure OpenAI 不支持的参数
-func transformRequestBody(body []byte, logger *zap.Logger) []byte {
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return body
+// extractStream 从请求体中解析 stream 字段
+func extractStream(body []byte) bool {
+	var req struct {
+		Stream bool `json:"stream"`
 	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return false
+	}
+	return req.Stream
+}
 
-	modified := false
+// invalidRequest 以 OpenAI 错误格式返回 400
+func invalidRequest(c *gin.Context, param, code, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"param":   param,
+			"code":    code,
+		},
+	})
+}
 
-	// 如果存在 max_tokens，转换为 max_completion_tokens
-	if maxTokens, exists := data["max_tokens"]; exists {
-		if _, hasNewParam := data["max_completion_tokens"]; !hasNewParam {
-			data["max_completion_tokens"] = maxTokens
-			delete(data, "max_tokens")
-			logger.Info("transformed max_tokens to max_completion_tokens",
-				zap.Any("value", maxTokens))
-			modified = true
-		}
+// splitModelTag 将 model@tag 或 model:tag 拆分为模型名称和标签
+func splitModelTag(model string) (base, tag string, ok bool) {
+	i := strings.LastIndexAny(model, "@:")
+	if i <= 0 || i == len(model)-1 {
+		return "", "", false
 	}
+	return model[:i], model[i+1:], true
+}
 
-	// 移除不支持的参数
-	for _, param := range unsupportedParams {
-		if _, exists := data[param]; exists {
-			delete(data, param)
-			logger.Info("removed unsupported parameter", zap.String("param", param))
-			modified = true
-		}
+// replaceModel 将请求体中的 model 字段替换为指定值，其余字段的原始 JSON 保持不变
+func replaceModel(body []byte, model string) []byte {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body
 	}
-
-	if !modified {
+	value, err := json.Marshal(model)
+	if err != nil {
 		return body
 	}
-
+	data["model"] = value
 	newBody, err := json.Marshal(data)
 	if err != nil {
 		return body
@@ -106,6 +198,11 @@ func (h *ProxyHandler) HandleChatCompletions(c *gin.Context) {
 	h.handleOpenAIRequest(c, "chat/completions")
 }
 
+// HandleAudioSpeech 处理文本转语音（TTS）请求，音频响应边接收边转发
+func (h *ProxyHandler) HandleAudioSpeech(c *gin.Context) {
+	h.handleOpenAIRequest(c, "audio/speech")
+}
+
 // HandleResponses 处理 Responses API 请求
 func (h *ProxyHandler) HandleResponses(c *gin.Context) {
 	h.handleOpenAIRequest(c, "responses")
@@ -119,7 +216,12 @@ func (h *ProxyHandler) handleOpenAIRequest(c *gin.Context, apiType string) {
 		zap.String("path", c.Request.URL.Path),
 	)
 
-	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+	body, err := h.readRequestBody(c)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		h.logger.Warn("request body read timed out", zap.Duration("read_timeout", h.cfg.Server.ReadTimeout))
+		c.JSON(http.StatusRequestTimeout, gin.H{"error": "timed out reading request body"})
+		return
+	}
 	if err != nil {
 		h.logger.Error("failed to read request body", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
@@ -131,9 +233,34 @@ func (h *ProxyHandler) handleOpenAIRequest(c *gin.Context, apiType string) {
 		return
 	}
 
-	h.logger.Debug("request body", zap.String("body", string(body)))
+	// 客户端压缩的请求体先解压，之后的解析、转换与转发都基于解压后的内容
+	if encoding := c.GetHeader("Content-Encoding"); encoding != "" {
+		body, err = decodeRequestBody(body, encoding)
+		if errors.Is(err, errBodyTooLarge) {
+			h.logger.Error("decompressed request body too large", zap.String("content_encoding", encoding))
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		if err != nil {
+			h.logger.Error("failed to decode request body", zap.String("content_encoding", encoding), zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	h.sampleBodyLog(c)
+	h.logBody(c, "request body", body)
 
-	model := extractModel(body)
+	model, rawModel := extractModel(body)
+	// 旧版 /v1/engines/{engine}/... 路径以引擎名称作为模型，忽略请求体中的 model
+	if engine := c.GetString(contextKeyEngine); engine != "" {
+		model = strings.TrimSpace(engine)
+	}
+	// 未指定 model 时使用 default_model，之后随模型名称规范化一并写入转发的请求体
+	if model == "" && h.cfg.DefaultModel != "" && isJSONObject(body) {
+		model = h.cfg.DefaultModel
+		h.logger.Info("using default model", zap.String("model", model))
+	}
 	if model == "" {
 		h.logger.Error("model field is missing from request body")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "model field is required"})
@@ -142,25 +269,267 @@ func (h *ProxyHandler) handleOpenAIRequest(c *gin.Context, apiType string) {
 
 	h.logger.Info("extracted model", zap.String("model", model))
 
-	if !h.lb.HasModel(model) {
+	// 解析为配置中的模型名称（开启 case_insensitive_models 时忽略大小写）
+	resolved, ok := h.lb.ResolveModel(model)
+	// 开启 model_tags 时，完整名称未配置再尝试拆分 @tag/:tag 后缀
+	var tag string
+	if !ok && h.cfg.LoadBalancer.ModelTags {
+		if base, t, found := splitModelTag(model); found {
+			if resolved, ok = h.lb.ResolveModel(base); ok {
+				tag = t
+			}
+		}
+	}
+	// 配置了 catch_all 时，未配置的模型交给兜底后端处理（首次请求时注册）
+	if !ok && h.lb.AddCatchAllModel(model) {
+		h.logger.Info("routing unconfigured model to catch_all backends", zap.String("model", model))
+		resolved, ok = model, true
+	}
+	if !ok {
 		h.logger.Error("model not configured", zap.String("model", model))
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %s is not configured", model)})
 		return
 	}
+	model = resolved
+
+	if !h.lb.ModelEnabled(model) {
+		h.logger.Warn("model disabled", zap.String("model", model))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("model %s is temporarily disabled", model)})
+		return
+	}
+
+	if remaining, open := h.lb.CircuitOpen(model); open {
+		h.logger.Warn("model circuit open, rejecting request", zap.String("model", model))
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "all backends failed",
+			"detail": fmt.Sprintf("all backends for model %s are unhealthy, retry after cooldown", model),
+		})
+		return
+	}
+
+	if tag != "" {
+		if !h.hasTaggedBackend(model, tag) {
+			h.logger.Error("no backends tagged for model", zap.String("model", model), zap.String("tag", tag))
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %s has no backends tagged %s", model, tag)})
+			return
+		}
+		h.logger.Info("backend tag selected", zap.String("model", model), zap.String("tag", tag))
+		c.Set(contextKeyBackendTag, tag)
+	}
+
+	// 按请求体字段路由，与 model@tag 同时生效时后端需同时带有两个标签
+	if routeTag, field := h.bodyRouteTag(body); routeTag != "" {
+		if !h.hasTaggedBackend(model, routeTag) {
+			h.logger.Error("no backends tagged for body route",
+				zap.String("model", model),
+				zap.String("field", field),
+				zap.String("tag", routeTag),
+			)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %s has no backends tagged %s", model, routeTag)})
+			return
+		}
+		h.logger.Info("body route selected", zap.String("model", model), zap.String("field", field), zap.String("tag", routeTag))
+		c.Set(contextKeyRouteTag, routeTag)
+	}
+
+	if pinned, ok := h.pinnedBackends(c, model); ok {
+		if len(pinned) == 0 {
+			// 热加载后固定的后端已不存在
+			h.logger.Error("pinned backend not configured", zap.String("model", model))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("pinned backend for model %s is not configured", model)})
+			return
+		}
+		h.logger.Info("using pinned backend for api key", zap.String("model", model), zap.String("deployment", pinned[0].Deployment))
+	} else if tier := h.keyTier(c); !h.hasTierBackend(model, tier) {
+		h.logger.Warn("no backends serve key tier", zap.String("model", model), zap.String("tier", tier))
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("model %s is not available for this API key's tier", model)})
+		return
+	}
 
-	// 转换请求参数（如 max_tokens -> max_completion_tokens）
-	body = transformRequestBody(body, h.logger)
+	// 发送前即确定是否为流式请求，以便选择超时策略并拒绝不支持流式的接口/模型
+	stream := extractStream(body)
+	if stream {
+		modelCfg, _ := h.lb.ModelConfig(model)
+		if apiType == "embeddings" || modelCfg.DisableStream {
+			h.logger.Warn("streaming not supported",
+				zap.String("model", model),
+				zap.String("api_type", apiType),
+			)
+			invalidRequest(c, "stream", "stream_not_supported",
+				fmt.Sprintf("Streaming is not supported for %s requests to model '%s'.", apiType, model))
+			return
+		}
+	}
+
+	// 内容审核，被拦截的请求不镜像也不转发
+	if !h.checkContentSafety(c, apiType, model, body) {
+		return
+	}
+
+	// 镜像原始请求体（转换前），便于回放到测试环境
+	h.mirror.record(c.Request.Method, c.Request.URL.Path, apiType, model, body)
 
-	h.proxyWithModel(c, model, body, apiType)
+	// 转发的请求体与后端查找使用同一个规范化后的模型名称
+	// 模型名称无需改写且没有转换器修改请求体时，原样转发客户端的请求体字节，不重新序列化，
+	// 客户端对请求体的哈希或签名仍然有效
+	if rawModel != model {
+		body = replaceModel(body, model)
+	}
+
+	// 按配置顺序执行请求体转换（如 max_tokens -> max_completion_tokens）
+	body, err = h.transforms.Transform(c.Request.Context(), apiType, body)
+	if err != nil {
+		h.logger.Warn("request transform failed", zap.Error(err))
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) {
+			invalidRequest(c, reqErr.Param, reqErr.Code, reqErr.Message)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	forward := func() {
+		// 开启拆分时，超长的 embeddings input 数组拆成多个分片并发转发
+		if apiType == "embeddings" && h.cfg.Embeddings.SplitBatchSize > 0 {
+			if chunks, ok := splitEmbeddingsInput(body, h.cfg.Embeddings.SplitBatchSize); ok {
+				h.proxySplitEmbeddings(c, model, body, chunks)
+				return
+			}
+		}
+		h.proxyWithModel(c, model, body, apiType, stream)
+	}
+
+	// 开启 coalescing 时，相同的进行中非流式请求只转发一次（音频响应不合并，避免缓冲完整音频）
+	if h.coalescer != nil && !stream && apiType != "audio/speech" {
+		h.coalesceRequest(c, apiType, model, body, forward)
+		return
+	}
+	forward()
+}
+
+// backendAPIVersion 从配置获取 api_version，如果未配置则使用默认值
+func backendAPIVersion(backend config.Backend) string {
+	if backend.APIVersion == "" {
+		return "2024-02-01"
+	}
+	return backend.APIVersion
+}
+
+// apiVersionChain 返回依次尝试的 api-version：api_version 在前，api_versions 回退链在后
+// OpenAI 后端不使用 api-version，只尝试一次
+func apiVersionChain(backend config.Backend) []string {
+	if backend.IsOpenAI() {
+		return []string{""}
+	}
+	versions := []string{backendAPIVersion(backend)}
+	for _, v := range backend.APIVersions {
+		if !slices.Contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// isAPIVersionError 判断 400 响应是否由当前 api-version 不支持的参数或特性引起
+func isAPIVersionError(body []byte) bool {
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return false
+	}
+	switch strings.ToLower(resp.Error.Code) {
+	case "unsupported_parameter", "unknown_parameter", "unsupportedapiversion", "invalidapiversion":
+		return true
+	}
+	message := strings.ToLower(resp.Error.Message)
+	return strings.Contains(message, "api version") || strings.Contains(message, "api-version")
 }
 
-func (h *ProxyHandler) proxyWithModel(c *gin.Context, model string, body []byte, apiType string) {
+// upstreamURL 构建目标 URL，template 为模型为该 API 类型配置的 URL 模板（url_templates），为空时使用默认路径
+func upstreamURL(backend config.Backend, apiType, apiVersion, template string) string {
+	endpoint := strings.TrimSuffix(backend.Endpoint, "/")
+	// OpenAI 后端路径中没有 deployment，也不需要 api-version
+	if backend.IsOpenAI() {
+		return endpoint + "/" + apiType
+	}
+	if template != "" {
+		return strings.NewReplacer(
+			"{endpoint}", endpoint,
+			"{deployment}", backend.Deployment,
+			"{api_version}", apiVersion,
+		).Replace(template)
+	}
+	if apiType == "responses" {
+		return fmt.Sprintf("%s/openai/responses?api-version=%s", endpoint, apiVersion)
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+		endpoint, backend.Deployment, apiType, apiVersion)
+}
+
+// urlTemplate 返回模型为该 API 类型配置的 URL 模板，未配置时为空
+func (h *ProxyHandler) urlTemplate(model, apiType string) string {
+	modelCfg, _ := h.lb.ModelConfig(model)
+	return modelCfg.URLTemplates[apiType]
+}
+
+// clientFor 返回该 API 类型的非流式请求使用的 client
+func (h *ProxyHandler) clientFor(apiType string) *http.Client {
+	if client, ok := h.apiClients[apiType]; ok {
+		return client
+	}
+	return h.client
+}
+
+// backendRequestBody 返回发往该后端的请求体
+// OpenAI 后端按名称识别模型，配置了 deployment 时替换请求体中的 model
+func backendRequestBody(backend config.Backend, body []byte) []byte {
+	if !backend.IsOpenAI() || backend.Deployment == "" {
+		return body
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body
+	}
+	// model 已与 deployment 相同时不重新序列化
+	var current string
+	if json.Unmarshal(data["model"], &current) == nil && current == backend.Deployment {
+		return body
+	}
+	data["model"], _ = json.Marshal(backend.Deployment)
+	newBody, err := json.Marshal(data)
+	if err != nil {
+		return body
+	}
+	return newBody
+}
+
+func (h *ProxyHandler) proxyWithModel(c *gin.Context, model string, body []byte, apiType string, stream bool) {
 	h.logger.Info("proxyWithModel called",
 		zap.String("model", model),
 		zap.String("api_type", apiType),
+		zap.Bool("stream", stream),
 	)
 
-	backends := h.lb.GetAllBackends(model)
+	backends := h.backendsFor(c, model)
+	if len(backends) == 0 && h.lb.ConcurrencyLimited(model) {
+		// 可选的后端全部达到 max_concurrent
+		h.logger.Warn("all backends at concurrency limit", zap.String("model", model))
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("all backends for model %s have reached their concurrency limit", model)})
+		return
+	}
+	if len(backends) == 0 && h.lb.ConfiguredBackends(model) > 0 {
+		// 模型配置了后端，但全部超出 RPM/TPM 配额
+		h.logger.Warn("all backends rate limited", zap.String("model", model))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("all backends for model %s have reached their rate limit", model)})
+		return
+	}
 	if len(backends) == 0 {
 		h.logger.Error("no backends available for model", zap.String("model", model))
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no backends available"})
@@ -169,13 +538,50 @@ func (h *ProxyHandler) proxyWithModel(c *gin.Context, model string, body []byte,
 
 	h.logger.Info("found backends", zap.Int("count", len(backends)))
 
+	// 非流式请求的整体超时按 API 类型选择（retry.timeouts）；
+	// 流式请求不能受 client 的整体超时约束，改用 stream_timeout 限制总时长，等待响应头的时间仍按 API 类型的超时约束
+	ctx := c.Request.Context()
+	timeout := h.cfg.Retry.TimeoutFor(apiType)
+	client := h.clientFor(apiType)
+	if stream {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.cfg.Retry.StreamTimeout)
+		defer cancel()
+		client = h.streamClient
+	}
+
 	var lastErr error
-	maxAttempts := h.cfg.Retry.MaxAttempts
-	if maxAttempts > len(backends) {
-		maxAttempts = len(backends)
+	// 每个后端连续尝试 per_backend_attempts 次后再切换，max_attempts 限制尝试的不同后端数
+	maxAttempts := h.cfg.Retry.TotalAttempts(len(backends))
+	// 调试模式：只尝试一次，失败时原样返回该后端的错误
+	noRetry := h.noRetry(c)
+	if noRetry {
+		maxAttempts = 1
 	}
+	var lastResp *http.Response
+	var lastRespBody []byte
 
+	var compressed []byte
+	var chain attemptChain
+	start := time.Now()
+	defer func() { h.logAttemptChain(c, model, chain, start) }()
+	// 当前尝试占用的进行中请求计数（least_conn 策略），换后端或返回时释放
+	release := func() {}
+	defer func() { release() }()
+attempts:
 	for i := 0; i < maxAttempts; i++ {
+		// 重试前按退避等待，超出重试时间预算时直接返回最后一次的错误
+		if i > 0 {
+			if err := h.waitRetry(c.Request.Context(), start, i); errors.Is(err, errRetryBudgetExhausted) {
+				h.logger.Warn("retry time budget exhausted",
+					zap.String("model", model),
+					zap.Int("attempts", i),
+					zap.Duration("elapsed", time.Since(start)),
+				)
+				break
+			}
+		}
+
 		// 检查 context 是否已取消
 		select {
 		case <-c.Request.Context().Done():
@@ -184,64 +590,172 @@ func (h *ProxyHandler) proxyWithModel(c *gin.Context, model string, body []byte,
 		default:
 		}
 
-		backend := backends[i%len(backends)]
+		backendIndex := h.cfg.Retry.BackendIndex(i)
+		backend := backends[backendIndex%len(backends)]
 
-		// 从配置获取 api_version，如果未配置则使用默认值
-		apiVersion := backend.Backend.APIVersion
-		if apiVersion == "" {
-			apiVersion = "2024-02-01"
+		// 先释放上一次尝试占用的并发数，再为本次尝试占用；达到 max_concurrent 时跳过该后端剩余的尝试
+		release()
+		next, ok := h.lb.BeginRequest(backend)
+		if !ok {
+			h.logger.Warn("backend at concurrency limit, skipping",
+				zap.String("model", model),
+				zap.Int("attempt", i+1),
+			)
+			lastErr = fmt.Errorf("backend concurrency limit reached")
+			chain.add(backend, "", 0, lastErr, time.Now())
+			for i+1 < maxAttempts && h.cfg.Retry.BackendIndex(i+1) == backendIndex {
+				i++
+			}
+			continue
 		}
 
-		// 构建目标 URL
-		var targetURL string
-		if apiType == "responses" {
-			targetURL = fmt.Sprintf("%s/openai/responses?api-version=%s",
-				strings.TrimSuffix(backend.Backend.Endpoint, "/"), apiVersion)
-		} else {
-			deploymentName := backend.Backend.Deployment
-			targetURL = fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
-				strings.TrimSuffix(backend.Backend.Endpoint, "/"), deploymentName, apiType, apiVersion)
+		// 扣减 RPM 配额，选出后端后配额可能已被并发请求耗尽，此时跳过该后端剩余的尝试
+		if !h.lb.AcquireRequest(backend) {
+			next()
+			h.logger.Warn("backend rate limited, skipping",
+				zap.String("model", model),
+				zap.Int("attempt", i+1),
+			)
+			lastErr = fmt.Errorf("backend rate limited")
+			chain.add(backend, "", 0, lastErr, time.Now())
+			for i+1 < maxAttempts && h.cfg.Retry.BackendIndex(i+1) == backendIndex {
+				i++
+			}
+			continue
 		}
+		release = next
 
-		h.logger.Info("proxying request",
-			zap.String("model", model),
-			zap.String("target_url", targetURL),
-			zap.String("api_version", apiVersion),
-			zap.Int("attempt", i+1),
+		// 依次尝试 api_version 及 api_versions 回退链：遇到 api-version 相关的 400 时，
+		// 先用下一个版本重试同一后端，再考虑故障转移
+		versions := apiVersionChain(backend.Backend)
+		var (
+			resp         *http.Response
+			targetURL    string
+			apiVersion   string
+			attemptStart time.Time
 		)
+		for vi := range versions {
+			apiVersion = versions[vi]
+			targetURL = upstreamURL(backend.Backend, apiType, apiVersion, h.urlTemplate(model, apiType))
 
-		req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, bytes.NewBuffer(body))
-		if err != nil {
-			h.logger.Error("failed to create request", zap.Error(err))
-			lastErr = err
-			continue
-		}
+			h.logger.Info("proxying request",
+				zap.String("model", model),
+				zap.String("target_url", targetURL),
+				zap.String("api_version", apiVersion),
+				zap.Int("attempt", i+1),
+			)
 
-		// 复制请求头
-		for key, values := range c.Request.Header {
-			for _, value := range values {
-				req.Header.Add(key, value)
+			// 后端支持时以 gzip 转发，压缩结果在多次尝试间复用（OpenAI 后端不支持 gzip，请求体不会被复用）
+			reqBody, gzipped := backendRequestBody(backend.Backend, body), false
+			if backend.Backend.GzipRequests {
+				if compressed == nil {
+					compressed, _ = gzipBody(body)
+				}
+				if compressed != nil {
+					reqBody, gzipped = compressed, true
+				}
 			}
-		}
-		req.Header.Set("api-key", backend.Backend.APIKey)
-		req.Header.Set("Content-Type", "application/json")
 
-		h.logger.Info("sending request to backend")
-		resp, err := h.client.Do(req)
-		if err != nil {
-			h.logger.Warn("backend request failed",
-				zap.String("target_url", targetURL),
-				zap.Error(err),
+			req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewBuffer(reqBody))
+			if err != nil {
+				// 构建请求失败通常是配置错误（如 endpoint 非法），换后端重试无意义，直接返回 500
+				h.logger.Error("failed to create request, backend is likely misconfigured",
+					zap.String("model", model),
+					zap.String("endpoint", backend.MaskedEndpoint()),
+					zap.String("deployment", backend.Backend.Deployment),
+					zap.Error(err),
+				)
+				chain.add(backend, apiVersion, 0, err, time.Now())
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":  "backend misconfigured",
+					"detail": fmt.Sprintf("failed to build upstream request for model %s (endpoint %s): check the backend endpoint/deployment configuration", model, backend.MaskedEndpoint()),
+				})
+				return
+			}
+
+			// 复制请求头
+			h.copyRequestHeaders(req.Header, c.Request.Header)
+			if err := h.setBackendAuth(ctx, req.Header, backend.Backend); err != nil {
+				h.logger.Warn("backend auth unavailable",
+					zap.String("model", model),
+					zap.String("endpoint", backend.MaskedEndpoint()),
+					zap.Error(err),
+				)
+				h.lb.MarkUnhealthy(model, backend)
+				lastErr = err
+				chain.add(backend, apiVersion, 0, err, time.Now())
+				continue attempts
+			}
+			req.Header.Set("Content-Type", "application/json")
+			// 显式设置 Accept-Encoding 后传输层不再请求 gzip，后端返回未压缩的响应
+			if backend.Backend.DisableCompression {
+				req.Header.Set("Accept-Encoding", "identity")
+			}
+			if gzipped {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			backendClient, err := h.backendClient(client, backend.Backend)
+			if err != nil {
+				h.logger.Warn("backend client unavailable",
+					zap.String("model", model),
+					zap.String("endpoint", backend.MaskedEndpoint()),
+					zap.Error(err),
+				)
+				h.lb.MarkUnhealthy(model, backend)
+				lastErr = err
+				chain.add(backend, apiVersion, 0, err, time.Now())
+				continue attempts
+			}
+
+			h.logger.Info("sending request to backend")
+			attemptStart = time.Now()
+			if stream {
+				resp, err = doWithHeaderTimeout(backendClient, req, timeout)
+			} else {
+				resp, err = backendClient.Do(req)
+			}
+			if err != nil {
+				h.logger.Warn("backend request failed",
+					zap.String("target_url", targetURL),
+					zap.Error(err),
+				)
+				h.lb.MarkUnhealthy(model, backend)
+				lastErr = err
+				chain.add(backend, apiVersion, 0, err, attemptStart)
+				continue attempts
+			}
+
+			h.logger.Info("received response from backend",
+				zap.Int("status_code", resp.StatusCode),
+				zap.String("proto", resp.Proto),
+				zap.Duration("ttfb", time.Since(attemptStart)),
+				zap.String("content_type", resp.Header.Get("Content-Type")),
 			)
-			h.lb.MarkUnhealthy(model, backend)
-			lastErr = err
-			continue
-		}
 
-		h.logger.Info("received response from backend",
-			zap.Int("status_code", resp.StatusCode),
-			zap.String("content_type", resp.Header.Get("Content-Type")),
-		)
+			if resp.StatusCode == http.StatusBadRequest && vi < len(versions)-1 {
+				respBody, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err == nil && isAPIVersionError(respBody) {
+					h.logger.Warn("request rejected by api version, retrying with next version",
+						zap.String("model", model),
+						zap.String("api_version", apiVersion),
+						zap.String("next_api_version", versions[vi+1]),
+						zap.String("body", string(respBody)),
+					)
+					chain.add(backend, apiVersion, resp.StatusCode, errors.New("api version rejected"), attemptStart)
+					continue
+				}
+				resp.Body = io.NopCloser(bytes.NewReader(respBody))
+			}
+			if vi > 0 && resp.StatusCode < http.StatusBadRequest {
+				h.logger.Info("api version upgrade resolved request",
+					zap.String("model", model),
+					zap.String("endpoint", backend.MaskedEndpoint()),
+					zap.String("api_version", apiVersion),
+				)
+			}
+			break
+		}
 
 		// 检查响应状态码
 		if resp.StatusCode >= 500 {
@@ -254,22 +768,136 @@ func (h *ProxyHandler) proxyWithModel(c *gin.Context, model string, body []byte,
 			)
 			h.lb.MarkUnhealthy(model, backend)
 			lastErr = fmt.Errorf("backend returned status %d", resp.StatusCode)
+			lastResp, lastRespBody = resp, respBody
+			chain.add(backend, apiVersion, resp.StatusCode, nil, attemptStart)
+			continue
+		}
+
+		// 以实际响应的 Content-Type 为准处理，与请求声明不一致时记录告警
+		isStream := strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream")
+		if isStream != stream {
+			h.logger.Warn("stream mode mismatch",
+				zap.String("model", model),
+				zap.Bool("requested", stream),
+				zap.Bool("responded", isStream),
+			)
+		}
+
+		if isStream {
+			// 向客户端写入任何内容之前先读到第一块数据，读取失败（包括没有任何数据就结束）时仍可切换到下一个后端；
+			// 数据开始转发后不再故障转移
+			first, err := readFirstChunk(resp.Body)
+			if err != nil {
+				resp.Body.Close()
+				if c.Request.Context().Err() != nil {
+					h.logger.Info("request cancelled by client")
+					return
+				}
+				h.logger.Warn("backend stream failed before first byte",
+					zap.String("target_url", targetURL),
+					zap.Error(err),
+				)
+				h.lb.MarkUnhealthy(model, backend)
+				lastErr = fmt.Errorf("backend stream failed before first byte: %w", err)
+				chain.add(backend, apiVersion, resp.StatusCode, lastErr, attemptStart)
+				continue
+			}
+			resp.Body = prependBody(first, resp.Body)
+			// 首字节时间（从发送上游请求到读到第一块数据）决定用户感知的响应速度，与总耗时分开记录
+			ttfb := time.Since(attemptStart)
+			c.Set(middleware.ContextKeyStreamTTFB, ttfb)
+			stats.GetInstance().RecordStreamTTFB(model, ttfb)
+
+			// 成功，标记为健康
+			h.lb.MarkHealthy(model, backend)
+			h.lb.RecordLatency(backend, time.Since(attemptStart))
+			chain.add(backend, apiVersion, resp.StatusCode, nil, attemptStart)
+			h.setUpstreamHeaders(c, backend, apiVersion, i+1)
+			h.logger.Info("handling stream response", zap.Duration("ttfb", ttfb))
+			u, ok := h.handleStreamResponse(c, resp, model)
+			h.recordUsage(c, model, backend, u, ok)
+			return
+		}
+
+		// TTS 的成功响应是二进制音频，不完整读入内存，直接转发
+		if apiType == "audio/speech" && resp.StatusCode < http.StatusMultipleChoices {
+			h.lb.MarkHealthy(model, backend)
+			h.lb.RecordLatency(backend, time.Since(attemptStart))
+			chain.add(backend, apiVersion, resp.StatusCode, nil, attemptStart)
+			h.setUpstreamHeaders(c, backend, apiVersion, i+1)
+			h.logger.Info("handling binary response", zap.String("content_type", resp.Header.Get("Content-Type")))
+			h.handleBinaryResponse(c, resp)
+			h.recordUsage(c, model, backend, usage{}, false)
+			return
+		}
+
+		// 非流式响应：先完整读取响应体，此时尚未向客户端写入任何内容，
+		// 读取失败可以安全地切换到下一个后端
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			h.logger.Warn("failed to read backend response",
+				zap.String("target_url", targetURL),
+				zap.Error(err),
+			)
+			h.lb.MarkUnhealthy(model, backend)
+			lastErr = fmt.Errorf("failed to read backend response: %w", err)
+			chain.add(backend, apiVersion, resp.StatusCode, lastErr, attemptStart)
 			continue
 		}
 
+		// 开启 validate_response 时，200 但响应体为空或不完整视为后端故障，切换到下一个后端
+		if h.cfg.Retry.ValidateResponse && resp.StatusCode == http.StatusOK {
+			if err := validateResponseBody(apiType, respBody); err != nil {
+				h.logger.Warn("backend returned invalid response body",
+					zap.String("target_url", targetURL),
+					zap.Int("body_size", len(respBody)),
+					zap.Error(err),
+				)
+				h.lb.MarkUnhealthy(model, backend)
+				lastErr = err
+				chain.add(backend, apiVersion, resp.StatusCode, err, attemptStart)
+				continue
+			}
+		}
+
 		// 成功，标记为健康
 		h.lb.MarkHealthy(model, backend)
+		h.lb.RecordLatency(backend, time.Since(attemptStart))
+		chain.add(backend, apiVersion, resp.StatusCode, nil, attemptStart)
 
-		// 检查是否为流式响应
-		if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
-			h.logger.Info("handling stream response")
-			h.handleStreamResponse(c, resp)
-			return
+		h.logBody(c, "response body", respBody)
+		if apiType == "responses" {
+			h.rememberResponse(respBody, backend.Backend.Endpoint)
 		}
 
-		// 非流式响应
+		u, ok := parseUsage(respBody)
+		u.FinishReasons = parseFinishReasons(respBody)
+		u.ContentFilter = parseContentFilter(respBody)
+		h.recordUsage(c, model, backend, u, ok)
+
+		h.setUpstreamHeaders(c, backend, apiVersion, i+1)
 		h.logger.Info("handling normal response")
-		h.handleNormalResponse(c, resp)
+		h.handleNormalResponse(c, resp, respBody)
+		return
+	}
+
+	// 调试模式、关闭 passive_health 或开启 return_last_error（且收到过后端响应）时原样返回最后一个后端的错误，而不是统一的 503
+	returnLastError := h.cfg.Retry.ReturnLastError && lastResp != nil
+	if noRetry || !h.lb.PassiveHealth() || returnLastError {
+		h.logger.Warn("returning last backend error",
+			zap.String("model", model),
+			zap.Bool("no_retry", noRetry),
+			zap.Error(lastErr),
+		)
+		if lastResp != nil {
+			c.Data(lastResp.StatusCode, lastResp.Header.Get("Content-Type"), lastRespBody)
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "backend request failed",
+			"detail": lastErr.Error(),
+		})
 		return
 	}
 
@@ -283,54 +911,392 @@ func (h *ProxyHandler) proxyWithModel(c *gin.Context, model string, body []byte,
 	})
 }
 
-func (h *ProxyHandler) handleStreamResponse(c *gin.Context, resp *http.Response) {
+// setUpstreamHeaders 开启 server.upstream_headers 时，在响应中标识实际处理请求的后端、api-version 及尝试次数
+func (h *ProxyHandler) setUpstreamHeaders(c *gin.Context, backend *loadbalancer.BackendStatus, apiVersion string, attempt int) {
+	if !h.cfg.Server.UpstreamHeaders {
+		return
+	}
+	c.Header("X-Upstream-Endpoint", backend.MaskedEndpoint())
+	c.Header("X-Upstream-Deployment", backend.Backend.Deployment)
+	c.Header("X-Upstream-Attempt", strconv.Itoa(attempt))
+	// 实际使用的 api-version（包括 api_versions 回退后的版本），OpenAI 后端不使用 api-version
+	if apiVersion != "" {
+		c.Header("X-Azure-Api-Version", apiVersion)
+	}
+}
+
+const (
+	headerOpenAIOrganization = "OpenAI-Organization"
+	headerOpenAIProject      = "OpenAI-Project"
+)
+
+// copyRequestHeaders 复制客户端请求头到上游请求
+// OpenAI-Organization/OpenAI-Project 不会被 Azure 识别，默认不转发；
+// 配置了 openai_headers 映射时改用对应的 header 名转发
+func (h *ProxyHandler) copyRequestHeaders(dst, src http.Header) {
+	for key, values := range src {
+		switch http.CanonicalHeaderKey(key) {
+		case http.CanonicalHeaderKey(headerOpenAIOrganization), http.CanonicalHeaderKey(headerOpenAIProject):
+			continue
+		// 转发的请求体已解压（或按后端配置重新压缩），长度和编码由上游请求自行设置
+		case "Content-Encoding", "Content-Length":
+			continue
+		// 响应的压缩由代理决定：转发客户端的 Accept-Encoding 会使传输层不再自动解压，
+		// 代理读到的是压缩后的响应体，无法解析用量，也可能与 server.response_compression 重复压缩
+		case "Accept-Encoding":
+			continue
+		case headerNoRetry, headerExcludeEndpoint:
+			continue
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+
+	if target := h.cfg.OpenAIHeaders.Organization; target != "" {
+		if value := src.Get(headerOpenAIOrganization); value != "" {
+			dst.Set(target, value)
+		}
+	}
+	if target := h.cfg.OpenAIHeaders.Project; target != "" {
+		if value := src.Get(headerOpenAIProject); value != "" {
+			dst.Set(target, value)
+		}
+	}
+}
+
+// recordUsage 记录一次成功请求的用量：扣减后端 TPM 配额、估算成本并计入按 key 的统计
+func (h *ProxyHandler) recordUsage(c *gin.Context, model string, backend *loadbalancer.BackendStatus, u usage, hasUsage bool) {
+	keyName := c.GetString(middleware.ContextKeyAPIKeyName)
+	if keyName == "" {
+		keyName = "anonymous"
+	}
+
+	attribution := middleware.GetAttribution(c)
+	// finish_reason 按模型计数，用于观察因 max_tokens 截断（length）的比例
+	finishReason := strings.Join(u.FinishReasons, ",")
+	stats.GetInstance().RecordFinishReasons(model, u.FinishReasons)
+	// 内容过滤只记录命中的类别，不记录内容本身，作为合规信号按模型和 key 计数
+	contentFilter := strings.Join(u.ContentFilter, ",")
+	stats.GetInstance().RecordContentFilter(model, keyName, u.ContentFilter)
+	if !hasUsage {
+		stats.GetInstance().Record(keyName, attribution, 0, 0, 0, 0)
+		if finishReason != "" || contentFilter != "" {
+			fields := []zap.Field{
+				zap.String("model", model),
+				zap.String("key_name", keyName),
+			}
+			if finishReason != "" {
+				fields = append(fields, zap.String("finish_reason", finishReason))
+			}
+			if contentFilter != "" {
+				fields = append(fields, zap.String("content_filter", contentFilter))
+			}
+			h.logger.Info("request finished", fields...)
+		}
+		return
+	}
+
+	// 拆分转发的 embeddings 请求已按分片扣减各后端的 TPM 配额
+	if backend != nil {
+		h.lb.RecordUsage(backend, u.TotalTokens)
+	}
+
+	fields := []zap.Field{
+		zap.String("model", model),
+		zap.String("key_name", keyName),
+		zap.Int("prompt_tokens", u.PromptTokens),
+		zap.Int("completion_tokens", u.CompletionTokens),
+		zap.Int("total_tokens", u.TotalTokens),
+	}
+	if finishReason != "" {
+		fields = append(fields, zap.String("finish_reason", finishReason))
+	}
+	if contentFilter != "" {
+		fields = append(fields, zap.String("content_filter", contentFilter))
+	}
+	if len(attribution) > 0 {
+		fields = append(fields, zap.Any("attribution", attribution))
+	}
+	cost, priced := h.cfg.EstimateCost(model, u.PromptTokens, u.CompletionTokens)
+	if priced {
+		fields = append(fields, zap.Float64("estimated_cost_usd", cost))
+	}
+	h.logger.Info("request usage", fields...)
+
+	stats.GetInstance().Record(keyName, attribution, u.PromptTokens, u.CompletionTokens, u.TotalTokens, cost)
+}
+
+// readRequestBody 读取请求体（最多 maxBodySize），配置了 server.read_timeout 时超时返回 os.ErrDeadlineExceeded
+// 读取完成后立即清除读取截止时间：net/http 之后在后台读取连接以检测客户端断开，过期的截止时间会使长时间的流式请求被误判为断开
+func (h *ProxyHandler) readRequestBody(c *gin.Context) ([]byte, error) {
+	timeout := h.cfg.Server.ReadTimeout
+	if timeout <= 0 {
+		return io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+	}
+
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		// 底层连接不支持截止时间时不限制
+		return io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+	_ = rc.SetReadDeadline(time.Time{})
+	return body, err
+}
+
+// handleStreamResponse 转发 SSE 流式响应，返回流中解析到的 usage
+func (h *ProxyHandler) handleStreamResponse(c *gin.Context, resp *http.Response, model string) (usage, bool) {
 	defer resp.Body.Close()
 
+	var parser streamParser
+	start := time.Now()
+	var written int64
+
+	// 达到 max_stream_duration 时关闭上游响应体，阻塞中的读取随之返回，后端停止生成
+	modelCfg, _ := h.lb.ModelConfig(model)
+	var durationExceeded atomic.Bool
+	if modelCfg.MaxStreamDuration > 0 {
+		timer := time.AfterFunc(modelCfg.MaxStreamDuration, func() {
+			durationExceeded.Store(true)
+			resp.Body.Close()
+		})
+		defer timer.Stop()
+	}
+
+	// 不设置 Content-Length 时 net/http 会自动对 HTTP/1.1 使用 chunked 编码，
+	// HTTP/2 则使用 DATA 帧分帧；Transfer-Encoding、Connection 属于逐跳头部，
+	// 手动设置会在 HTTP/1.1 下与自动分块冲突，在 HTTP/2 下属于非法头部
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Transfer-Encoding", "chunked")
+	// 禁止 nginx 等反向代理缓冲 SSE
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(resp.StatusCode)
 
+	// 每次读取一个缓冲区并同步写出，客户端消费慢时写入阻塞，不会继续读取上游
+	buf := make([]byte, 4096)
+	pacer := newStreamPacer(h.cfg.Server.StreamPacing)
+	guard := newStreamEventGuard(h.cfg.Server)
+	ctx := c.Request.Context()
+	// 客户端断开时关闭上游响应体，即使上游请求未绑定客户端 context，阻塞中的读取也会立即返回
+	stopClose := context.AfterFunc(ctx, func() { resp.Body.Close() })
+	defer stopClose()
 	c.Stream(func(w io.Writer) bool {
-		buf := make([]byte, 4096)
+		// 客户端已断开时立即结束，返回后关闭上游响应体，后端随之停止生成，不再消耗 token
+		if ctx.Err() != nil {
+			h.logger.Info("client disconnected during stream")
+			return false
+		}
 		n, err := resp.Body.Read(buf)
+		if ctx.Err() != nil {
+			h.logger.Info("client disconnected during stream")
+			return false
+		}
 		if n > 0 {
-			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+			data, oversized := guard.filter(buf[:n])
+			if oversized {
+				h.logger.Warn("oversized stream event",
+					zap.String("model", model),
+					zap.Int("max_stream_event_size", h.cfg.Server.MaxStreamEventSize),
+					zap.String("action", h.cfg.Server.OversizedStreamEvent),
+				)
+			}
+			parser.feed(data)
+			if _, writeErr := w.Write(data); writeErr != nil {
 				h.logger.Warn("failed to write stream response", zap.Error(writeErr))
 				return false
 			}
 			c.Writer.Flush()
+			written += int64(len(data))
+			if oversized && h.cfg.Server.OversizedStreamEvent == config.OversizedStreamEventError {
+				h.writeStreamEventTooLarge(c, w)
+				return false
+			}
+			if !pacer.wait(ctx, data) {
+				return false
+			}
+		}
+		if err == nil && modelCfg.MaxStreamBytes > 0 && written >= modelCfg.MaxStreamBytes {
+			h.writeStreamCutoff(c, w, model, "max_stream_bytes", written, time.Since(start))
+			return false
 		}
 		if err != nil && err != io.EOF {
+			if durationExceeded.Load() {
+				h.writeStreamCutoff(c, w, model, "max_stream_duration", written, time.Since(start))
+				return false
+			}
 			h.logger.Warn("error reading stream", zap.Error(err))
+			h.writeStreamError(c, w, err)
 		}
 		return err == nil
 	})
+
+	return parser.result()
+}
+
+// readFirstChunk 读取流式响应体的第一块非空数据，没有任何数据就结束时返回 io.ErrUnexpectedEOF
+func readFirstChunk(body io.Reader) ([]byte, error) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			return buf[:n], nil
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// prependBody 将已读取的数据放回响应体开头，关闭时仍关闭原响应体
+func prependBody(data []byte, body io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), body), body}
 }
 
-func (h *ProxyHandler) handleNormalResponse(c *gin.Context, resp *http.Response) {
+// streamInterruptedEvent 上游流式响应中途出错时发送给客户端的错误事件
+// 前置空行结束可能未写完的事件，之后不再发送 [DONE]
+var streamInterruptedEvent = []byte("\n\ndata: {\"error\":{\"message\":\"The upstream stream was interrupted before completion.\",\"type\":\"server_error\",\"code\":\"stream_interrupted\"}}\n\n")
+
+// writeStreamError 开启 server.stream_error_event 时，通知客户端流式响应被中断
+// 客户端已断开时不再写入
+func (h *ProxyHandler) writeStreamError(c *gin.Context, w io.Writer, err error) {
+	if !h.cfg.Server.StreamErrorEvent || c.Request.Context().Err() != nil {
+		return
+	}
+	if _, writeErr := w.Write(streamInterruptedEvent); writeErr != nil {
+		h.logger.Warn("failed to write stream error event", zap.Error(writeErr))
+		return
+	}
+	c.Writer.Flush()
+	h.logger.Info("sent stream error event to client", zap.NamedError("stream_error", err))
+}
+
+// streamLimitEvent 流式响应超出模型的 max_stream_duration/max_stream_bytes 被截断时发送给客户端的事件
+var streamLimitEvent = []byte("\n\ndata: {\"error\":{\"message\":\"The stream was cut off by the proxy after reaching the configured limit.\",\"type\":\"server_error\",\"code\":\"stream_limit_exceeded\"}}\n\n")
+
+// writeStreamCutoff 记录流式响应被截断并通知客户端，限制为显式配置，不受 server.stream_error_event 影响
+func (h *ProxyHandler) writeStreamCutoff(c *gin.Context, w io.Writer, model, limit string, written int64, elapsed time.Duration) {
+	h.logger.Warn("stream limit exceeded, closing upstream",
+		zap.String("model", model),
+		zap.String("limit", limit),
+		zap.Int64("bytes", written),
+		zap.Duration("duration", elapsed),
+	)
+	if c.Request.Context().Err() != nil {
+		return
+	}
+	if _, err := w.Write(streamLimitEvent); err != nil {
+		h.logger.Warn("failed to write stream limit event", zap.Error(err))
+		return
+	}
+	c.Writer.Flush()
+}
+
+// streamEventTooLargeEvent 上游单个 SSE 事件超出 server.max_stream_event_size 且处理方式为 error 时发送给客户端的事件
+var streamEventTooLargeEvent = []byte("\n\ndata: {\"error\":{\"message\":\"The upstream sent a stream event larger than the proxy allows.\",\"type\":\"server_error\",\"code\":\"stream_event_too_large\"}}\n\n")
+
+// writeStreamEventTooLarge 通知客户端流式响应因超长事件被结束，返回后关闭上游响应体
+func (h *ProxyHandler) writeStreamEventTooLarge(c *gin.Context, w io.Writer) {
+	if c.Request.Context().Err() != nil {
+		return
+	}
+	if _, err := w.Write(streamEventTooLargeEvent); err != nil {
+		h.logger.Warn("failed to write stream event too large event", zap.Error(err))
+		return
+	}
+	c.Writer.Flush()
+}
+
+// handleBinaryResponse 将二进制响应（如音频）按块转发给客户端，保留上游的 Content-Type
+// 每次只读取一个缓冲区并同步写出，不会在内存中缓冲完整响应
+func (h *ProxyHandler) handleBinaryResponse(c *gin.Context, resp *http.Response) {
 	defer resp.Body.Close()
 
-	// 复制响应头
+	for _, key := range []string{"Content-Type", "Content-Length", "Content-Disposition"} {
+		if value := resp.Header.Get(key); value != "" {
+			c.Header(key, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				h.logger.Warn("failed to write binary response", zap.Error(writeErr))
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			h.logger.Warn("error reading binary response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// handleNormalResponse 将已完整读取的非流式响应写回客户端
+func (h *ProxyHandler) handleNormalResponse(c *gin.Context, resp *http.Response, body []byte) {
+	// 复制响应头：c.Header 会覆盖同名头部，多值头部（如多个 Set-Cookie）需逐个追加才能保留后端返回的全部取值；
+	// 追加前先删除此前设置的同名头部，后端返回的头部仍然优先
+	header := c.Writer.Header()
 	for key, values := range resp.Header {
+		header.Del(key)
 		for _, value := range values {
-			c.Header(key, value)
+			header.Add(key, value)
 		}
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read response"})
-		return
+	if compressed, ok := h.compressResponse(c, resp, body); ok {
+		h.logger.Debug("compressed response",
+			zap.Int("size", len(body)),
+			zap.Int("compressed_size", len(compressed)),
+		)
+		c.Header("Content-Encoding", "gzip")
+		c.Header("Content-Length", strconv.Itoa(len(compressed)))
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		body = compressed
 	}
 
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
 }
 
 // HandleHealth 健康检查接口
+// 后端健康检查循环超过 3 倍检查间隔未运行时返回 503 degraded，此时不健康的后端不会再恢复
 func (h *ProxyHandler) HandleHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"status":    "ok",
 		"timestamp": time.Now().Format(time.RFC3339),
-	})
+	}
+	last, stale := h.lb.HealthCheckStatus()
+	if !last.IsZero() {
+		resp["health_check_last_run"] = last.Format(time.RFC3339)
+	}
+	if stale {
+		h.logger.Error("health check loop has not run recently", zap.Time("last_run", last))
+		resp["status"] = "degraded"
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleReady 就绪检查接口
+// 开启 health_check.readiness_gate 时，启动后对所有后端的首次主动探测完成前返回 503，避免编排系统过早导入流量
+func (h *ProxyHandler) HandleReady(c *gin.Context) {
+	if h.cfg.HealthCheck.ReadinessGate && !h.lb.InitialCheckDone() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
 }
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/loadbalancer"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// streamRecorder 支持 CloseNotify 的 ResponseRecorder，gin 的 Context.Stream 依赖该接口
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func newStreamRecorder() *streamRecorder {
+	return &streamRecorder{ResponseRecorder: httptest.NewRecorder(), closed: make(chan bool, 1)}
+}
+
+func (r *streamRecorder) CloseNotify() <-chan bool {
+	return r.closed
+}
+
+// trackingBody 记录响应体是否被关闭
+type trackingBody struct {
+	io.ReadCloser
+	closed atomic.Bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed.Store(true)
+	return b.ReadCloser.Close()
+}
+
+func newTestProxyHandler(t *testing.T, cfg *config.Config) *ProxyHandler {
+	t.Helper()
+	h, err := NewProxyHandler(loadbalancer.GetInstance(), cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProxyHandler: %v", err)
+	}
+	return h
+}
+
+func TestStreamStopsOnClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// 上游发送一个事件后长时间不再发送，模拟生成缓慢的后端
+	upstreamDone := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(upstreamDone)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	h := newTestProxyHandler(t, &config.Config{})
+
+	// 上游请求使用独立的 context，只取消客户端一侧，确认处理器自身会关闭上游响应体
+	upstreamCtx, cancelUpstream := context.WithCancel(context.Background())
+	defer cancelUpstream()
+	req, _ := http.NewRequestWithContext(upstreamCtx, http.MethodGet, upstream.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upstream request: %v", err)
+	}
+	body := &trackingBody{ReadCloser: resp.Body}
+	resp.Body = body
+
+	clientCtx, cancelClient := context.WithCancel(context.Background())
+	defer cancelClient()
+	rec := newStreamRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(clientCtx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.handleStreamResponse(c, resp, "gpt-4")
+	}()
+
+	// 第一个事件转发后客户端断开
+	time.Sleep(100 * time.Millisecond)
+	cancelClient()
+
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("handleStreamResponse did not return after client disconnect")
+	}
+	if !strings.Contains(rec.Body.String(), `"content":"hi"`) {
+		t.Errorf("first event was not forwarded, got %q", rec.Body.String())
+	}
+	if !body.closed.Load() {
+		t.Error("upstream response body was not closed")
+	}
+	select {
+	case <-upstreamDone:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("upstream connection still open after client disconnect")
+	}
+}
+
+// newUpstreamTestHandler 创建转发到 upstream 的处理器，配置经 config.Read 加载以获得与运行时相同的默认值
+func newUpstreamTestHandler(t *testing.T, upstreamURL, extra string) *ProxyHandler {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := extra + `
+models:
+  gpt-4:
+    backends:
+      - endpoint: "` + upstreamURL + `"
+        api_key: test
+        deployment: gpt-4
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Read(path)
+	if err != nil {
+		t.Fatalf("config.Read: %v", err)
+	}
+	h := newTestProxyHandler(t, cfg)
+	h.lb.Reload(cfg)
+	return h
+}
+
+func TestRequestBodyForwardedVerbatim(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var received []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	h := newUpstreamTestHandler(t, upstream.URL, `
+loadbalancer:
+  case_insensitive_models: true
+`)
+	router := gin.New()
+	router.POST("/v1/chat/completions", h.HandleChatCompletions)
+
+	send := func(body string) {
+		t.Helper()
+		received = nil
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	// 字段顺序、空白与数字写法都与重新序列化的结果不同
+	t.Run("no transform and model unchanged", func(t *testing.T) {
+		body := "{ \"messages\" : [ {\"content\":\"hi\",  \"role\":\"user\"} ],\n\t\"temperature\": 0.50,\n\t\"model\":\"gpt-4\" ,\"seed\":12345678901234567890 }"
+		send(body)
+		if !bytes.Equal(received, []byte(body)) {
+			t.Errorf("upstream body changed:\n got %s\nwant %s", received, body)
+		}
+	})
+
+	// 模型名称需要改写时只替换 model，其余字段的原始 JSON（如 0.50、大整数）保持不变
+	t.Run("model rewritten", func(t *testing.T) {
+		send("{ \"model\":\"GPT-4\", \"temperature\": 0.50, \"seed\":12345678901234567890, \"messages\":[{\"role\":\"user\",\"content\":\"hi\"}] }")
+		var got map[string]json.RawMessage
+		if err := json.Unmarshal(received, &got); err != nil {
+			t.Fatalf("upstream body is not JSON: %s", received)
+		}
+		if string(got["model"]) != `"gpt-4"` {
+			t.Errorf("model = %s, want \"gpt-4\"", got["model"])
+		}
+		if string(got["temperature"]) != "0.50" || string(got["seed"]) != "12345678901234567890" {
+			t.Errorf("raw values changed: temperature=%s seed=%s", got["temperature"], got["seed"])
+		}
+	})
+}
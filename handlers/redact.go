@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const redactedValue = "[REDACTED]"
+
+// redactJSON 将 JSON 中指定字段（任意层级）的值替换为 [REDACTED]
+// 未配置字段或请求体不是合法 JSON 时原样返回
+func redactJSON(body []byte, fields map[string]struct{}) []byte {
+	if len(fields) == 0 {
+		return body
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return body
+	}
+
+	redacted, err := json.Marshal(redactValue(data, fields))
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func redactValue(v interface{}, fields map[string]struct{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if _, ok := fields[k]; ok {
+				val[k] = redactedValue
+				continue
+			}
+			val[k] = redactValue(child, fields)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(child, fields)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// redactFieldSet 将字段列表转换为集合
+func redactFieldSet(fields []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		set[f] = struct{}{}
+	}
+	return set
+}
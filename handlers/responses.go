@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/loadbalancer"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	responseOwnerTTL        = 24 * time.Hour
+	maxResponseOwnerEntries = 10000
+)
+
+// responseIDPattern 合法的 response id，防止路径穿越到其他 Azure 接口
+var responseIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// responseOwners 记录 response id 由哪个端点创建，子资源请求优先发往该端点
+// response 保存在创建它的 Azure 资源上，未命中缓存时只能逐个端点尝试
+type responseOwners struct {
+	owners map[string]responseOwner
+	mu     sync.Mutex
+}
+
+type responseOwner struct {
+	endpoint  string
+	expiresAt time.Time
+}
+
+func (o *responseOwners) get(id string) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	owner, ok := o.owners[id]
+	if !ok || time.Now().After(owner.expiresAt) {
+		return "", false
+	}
+	return owner.endpoint, true
+}
+
+func (o *responseOwners) remember(id, endpoint string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.owners == nil {
+		o.owners = make(map[string]responseOwner)
+	}
+	if _, ok := o.owners[id]; !ok && len(o.owners) >= maxResponseOwnerEntries {
+		// 容量已满时淘汰任意一个条目，缓存只是优化，未命中时会回退到逐个尝试
+		for key := range o.owners {
+			delete(o.owners, key)
+			break
+		}
+	}
+	o.owners[id] = responseOwner{endpoint: endpoint, expiresAt: time.Now().Add(responseOwnerTTL)}
+}
+
+// rememberResponse 从 Responses API 的响应中解析 id 并记录创建它的端点
+func (h *ProxyHandler) rememberResponse(body []byte, endpoint string) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.ID == "" {
+		return
+	}
+	h.responseOwners.remember(resp.ID, strings.TrimSuffix(endpoint, "/"))
+}
+
+// HandleResponseResource 代理 Responses API 子资源：
+// GET/DELETE /v1/responses/{id} 与 GET /v1/responses/{id}/input_items
+func (h *ProxyHandler) HandleResponseResource(c *gin.Context) {
+	id := c.Param("id")
+	if !responseIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid response id"})
+		return
+	}
+	suffix := "/" + id
+	if strings.HasSuffix(c.FullPath(), "/input_items") {
+		suffix += "/input_items"
+	}
+
+	candidates := h.responseBackends(id)
+	if len(candidates) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no backends available"})
+		return
+	}
+
+	var lastErr error
+	var notFound []byte
+	for i, backend := range candidates {
+		endpoint := strings.TrimSuffix(backend.Endpoint, "/")
+		query := c.Request.URL.Query()
+		targetURL := endpoint + "/responses" + suffix
+		if !backend.IsOpenAI() {
+			query.Set("api-version", backendAPIVersion(backend))
+			targetURL = endpoint + "/openai/responses" + suffix
+		}
+		if len(query) > 0 {
+			targetURL += "?" + query.Encode()
+		}
+
+		req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		h.copyRequestHeaders(req.Header, c.Request.Header)
+		if err := h.setBackendAuth(c.Request.Context(), req.Header, backend); err != nil {
+			lastErr = err
+			continue
+		}
+
+		client, err := h.backendClient(h.client, backend)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			h.logger.Warn("response resource request failed",
+				zap.String("endpoint", loadbalancer.MaskEndpoint(endpoint)),
+				zap.Error(err),
+			)
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			// response 不在该端点上，继续尝试下一个
+			notFound = body
+			continue
+		case resp.StatusCode >= http.StatusInternalServerError:
+			lastErr = fmt.Errorf("backend returned status %d", resp.StatusCode)
+			continue
+		}
+
+		h.logger.Info("response resource served",
+			zap.String("response_id", id),
+			zap.String("endpoint", loadbalancer.MaskEndpoint(endpoint)),
+			zap.Int("attempt", i+1),
+		)
+		if resp.StatusCode < http.StatusMultipleChoices {
+			h.responseOwners.remember(id, endpoint)
+		}
+		h.handleNormalResponse(c, resp, body)
+		return
+	}
+
+	if notFound != nil && lastErr == nil {
+		c.Data(http.StatusNotFound, "application/json", notFound)
+		return
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("response %s not found on any backend", id)
+	}
+	h.logger.Error("all backends failed", zap.String("response_id", id), zap.Error(lastErr))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":  "all backends failed",
+		"detail": lastErr.Error(),
+	})
+}
+
+// responseBackends 返回按端点去重的候选后端，记录过创建端点时排在最前
+func (h *ProxyHandler) responseBackends(id string) []config.Backend {
+	seen := make(map[string]bool)
+	var candidates []config.Backend
+	for _, modelCfg := range h.lb.ModelConfigs() {
+		for _, backend := range modelCfg.Backends {
+			endpoint := strings.TrimSuffix(backend.Endpoint, "/")
+			if seen[endpoint] {
+				continue
+			}
+			seen[endpoint] = true
+			candidates = append(candidates, backend)
+		}
+	}
+
+	owner, _ := h.responseOwners.get(id)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ei := strings.TrimSuffix(candidates[i].Endpoint, "/")
+		ej := strings.TrimSuffix(candidates[j].Endpoint, "/")
+		if (ei == owner) != (ej == owner) {
+			return ei == owner
+		}
+		return ei < ej
+	})
+	return candidates
+}
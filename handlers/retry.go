@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"azure-openai-proxy/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// headerNoRetry 管理员 key 调试用请求头，为 true 时只尝试第一个后端并原样返回其错误
+const headerNoRetry = "X-No-Retry"
+
+// errRetryBudgetExhausted 重试总耗时即将超出 retry.max_elapsed
+var errRetryBudgetExhausted = errors.New("retry time budget exhausted")
+
+// retryDelay 第 n 次重试前的退避时间（n 从 1 开始），从 retry.backoff 开始每次翻倍，不超过 retry.max_backoff（大于 0 时）
+func (h *ProxyHandler) retryDelay(n int) time.Duration {
+	delay := h.cfg.Retry.Backoff
+	if delay <= 0 {
+		return 0
+	}
+	maxBackoff := h.cfg.Retry.MaxBackoff
+	for i := 1; i < n && (maxBackoff <= 0 || delay < maxBackoff); i++ {
+		delay *= 2
+	}
+	if maxBackoff > 0 {
+		delay = min(delay, maxBackoff)
+	}
+	return delay
+}
+
+// withJitter 按 retry.jitter 随机缩短等待时间，结果在 [delay×(1-jitter), delay] 之间，不会超过 max_backoff
+// 所有需要等待后再重试的地方都应经过这里，避免同时失败的请求在同一时刻再次涌向后端
+func (h *ProxyHandler) withJitter(delay time.Duration) time.Duration {
+	jitter := h.cfg.Retry.Jitter
+	if jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	return delay - time.Duration(rand.Float64()*jitter*float64(delay))
+}
+
+// waitRetry 在第 n 次重试前按退避等待
+// 等待后的总耗时会超出 retry.max_elapsed 时不再重试，返回 errRetryBudgetExhausted；ctx 取消时返回 ctx.Err()
+func (h *ProxyHandler) waitRetry(ctx context.Context, start time.Time, n int) error {
+	delay := h.withJitter(h.retryDelay(n))
+	if budget := h.cfg.Retry.MaxElapsed; budget > 0 && time.Since(start)+delay >= budget {
+		return errRetryBudgetExhausted
+	}
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// responseRequiredFields 校验非流式成功响应时各 API 类型必须包含的字段
+var responseRequiredFields = map[string]string{
+	"chat/completions": "choices",
+	"completions":      "choices",
+	"embeddings":       "data",
+	"responses":        "output",
+}
+
+// validateResponseBody 检查非流式成功响应是否为包含预期字段的 JSON 对象（retry.validate_response）
+// 用于发现后端返回 200 但响应体为空或被截断的情况
+func validateResponseBody(apiType string, body []byte) error {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fmt.Errorf("invalid response body: %w", err)
+	}
+	if field, ok := responseRequiredFields[apiType]; ok {
+		if value, found := data[field]; !found || string(value) == "null" {
+			return fmt.Errorf("invalid response body: missing %q", field)
+		}
+	}
+	return nil
+}
+
+// noRetry 检查请求是否通过 X-No-Retry 关闭重试，仅对管理员 key 生效
+func (h *ProxyHandler) noRetry(c *gin.Context) bool {
+	value := c.GetHeader(headerNoRetry)
+	if value == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil || !enabled {
+		return false
+	}
+	keyName := c.GetString(middleware.ContextKeyAPIKeyName)
+	if !h.cfg.IsAdminKey(keyName) {
+		h.logger.Warn("ignoring X-No-Retry from non-admin key", zap.String("key_name", keyName))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import "azure-openai-proxy/config"
+
+// streamEventGuard 限制流式响应中单个 SSE 事件的大小（server.max_stream_event_size），
+// 按空行识别事件边界，事件超出上限时按 server.oversized_stream_event 处理。
+// 只记录当前事件的字节数，不缓冲事件内容，异常后端发送的超长事件不会占用额外内存
+type streamEventGuard struct {
+	max      int
+	mode     string
+	size     int  // 当前事件已读取的字节数（不含结束事件的空行）
+	lineLen  int  // 当前行除 \r 外的字节数，为 0 时遇到 \n 表示空行
+	exceeded bool // 当前事件已超出上限
+}
+
+// newStreamEventGuard 未配置上限时返回 nil
+func newStreamEventGuard(cfg config.ServerConfig) *streamEventGuard {
+	if cfg.MaxStreamEventSize <= 0 {
+		return nil
+	}
+	return &streamEventGuard{max: cfg.MaxStreamEventSize, mode: cfg.OversizedStreamEvent}
+}
+
+// filter 检查一块上游数据，返回应转发给客户端的部分，以及本块中是否有事件新超出上限
+// passthrough 原样返回；truncate 丢弃超长事件超出上限的部分，在事件结束时补上空行；
+// error 返回超出上限之前的部分，调用方随后发送错误事件并结束响应
+func (g *streamEventGuard) filter(chunk []byte) ([]byte, bool) {
+	if g == nil {
+		return chunk, false
+	}
+	var out []byte // truncate 模式下有数据被丢弃时才分配
+	copied := 0    // chunk 中已复制到 out 的长度
+	newlyExceeded := false
+	for i, b := range chunk {
+		if b == '\n' && g.lineLen == 0 {
+			// 空行，当前事件结束
+			if g.exceeded && g.mode == config.OversizedStreamEventTruncate {
+				// 被截断的事件停在行中间，补上换行与空行
+				out = append(out, '\n', '\n')
+				copied = i + 1
+			}
+			g.size = 0
+			g.exceeded = false
+			continue
+		}
+		switch b {
+		case '\n':
+			g.lineLen = 0
+		case '\r':
+		default:
+			g.lineLen++
+		}
+		g.size++
+		if g.size <= g.max {
+			continue
+		}
+		if !g.exceeded {
+			g.exceeded = true
+			newlyExceeded = true
+			if g.mode == config.OversizedStreamEventError {
+				return chunk[:i], true
+			}
+		}
+		if g.mode == config.OversizedStreamEventTruncate {
+			// 丢弃该字节：先保留之前尚未复制的部分
+			if out == nil {
+				out = make([]byte, 0, len(chunk))
+			}
+			out = append(out, chunk[copied:i]...)
+			copied = i + 1
+		}
+	}
+	if out == nil {
+		return chunk, newlyExceeded
+	}
+	return append(out, chunk[copied:]...), newlyExceeded
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"azure-openai-proxy/config"
+
+	"go.uber.org/zap"
+)
+
+// RequestTransformer 请求体转换器
+// Transform 返回转换后的请求体，无需修改时应原样返回输入；返回 error 时请求以 400 拒绝
+type RequestTransformer interface {
+	Transform(apiType string, body []byte) ([]byte, error)
+}
+
+// ContextTransformer 需要请求上下文的转换器（如下载远程资源），转换器链优先调用 TransformContext，
+// 客户端断开时应尽快返回
+type ContextTransformer interface {
+	TransformContext(ctx context.Context, apiType string, body []byte) ([]byte, error)
+}
+
+// TransformerFactory 根据配置创建转换器
+type TransformerFactory func(cfg *config.Config, logger *zap.Logger) (RequestTransformer, error)
+
+var transformerRegistry = map[string]TransformerFactory{
+	"reject_params":      newRejectParamsTransformer,
+	"max_tokens":         newMaxTokensTransformer,
+	"unsupported_params": newUnsupportedParamsTransformer,
+	"image_urls":         newImageURLTransformer,
+	"clamp_params":       newClampParamsTransformer,
+}
+
+// RequestError 转换器拒绝请求时返回的错误，以 OpenAI 错误格式返回给客户端
+type RequestError struct {
+	Param   string
+	Code    string
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// RegisterTransformer 注册自定义转换器，需在 NewProxyHandler 之前调用（通常在 init 中）
+// 注册后即可在配置的 transforms 列表中按名称引用
+func RegisterTransformer(name string, factory TransformerFactory) {
+	transformerRegistry[name] = factory
+}
+
+// transformChain 按配置顺序组合的转换器链
+type transformChain []RequestTransformer
+
+// newTransformChain 按名称列表从注册表创建转换器链
+func newTransformChain(names []string, cfg *config.Config, logger *zap.Logger) (transformChain, error) {
+	chain := make(transformChain, 0, len(names))
+	for _, name := range names {
+		factory, ok := transformerRegistry[name]
+		if !ok {
+			known := make([]string, 0, len(transformerRegistry))
+			for k := range transformerRegistry {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown transform %q, available: %v", name, known)
+		}
+		t, err := factory(cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("transform %q: %w", name, err)
+		}
+		chain = append(chain, t)
+	}
+	return chain, nil
+}
+
+// Transform 依次执行链上的转换器，ctx 为客户端请求的上下文
+func (c transformChain) Transform(ctx context.Context, apiType string, body []byte) ([]byte, error) {
+	var err error
+	for _, t := range c {
+		if ct, ok := t.(ContextTransformer); ok {
+			body, err = ct.TransformContext(ctx, apiType, body)
+		} else {
+			body, err = t.Transform(apiType, body)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// transformJSONObject 将请求体解析为 JSON 对象后交给 fn 修改，fn 返回 true 时重新序列化
+// 请求体不是 JSON 对象时原样返回，由后端决定如何处理
+// 数字解析为 json.Number 并按原文输出，避免 seed 等大整数或高精度数值经 float64 往返后被改变
+func transformJSONObject(body []byte, fn func(data map[string]interface{}) bool) ([]byte, error) {
+	var data map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil || decoder.More() {
+		return body, nil
+	}
+	if !fn(data) {
+		return body, nil
+	}
+	newBody, err := json.Marshal(data)
+	if err != nil {
+		return body, nil
+	}
+	return newBody, nil
+}
+
+// maxTokensTransformer 将 max_tokens 转换为 max_completion_tokens（新版 Azure OpenAI API 要求）
+// 旧版 completions 接口只支持 max_tokens，不做转换
+type maxTokensTransformer struct {
+	logger *zap.Logger
+}
+
+func newMaxTokensTransformer(_ *config.Config, logger *zap.Logger) (RequestTransformer, error) {
+	return &maxTokensTransformer{logger: logger}, nil
+}
+
+func (t *maxTokensTransformer) Transform(apiType string, body []byte) ([]byte, error) {
+	if apiType == "completions" {
+		return body, nil
+	}
+	return transformJSONObject(body, func(data map[string]interface{}) bool {
+		maxTokens, exists := data["max_tokens"]
+		if !exists {
+			return false
+		}
+		if _, hasNewParam := data["max_completion_tokens"]; hasNewParam {
+			return false
+		}
+		data["max_completion_tokens"] = maxTokens
+		delete(data, "max_tokens")
+		t.logger.Info("transformed max_tokens to max_completion_tokens",
+			zap.Any("value", maxTokens))
+		return true
+	})
+}
+
+// unsupportedParamsTransformer 移除 Azure OpenAI 不支持或策略上不允许的参数（params.strip）
+type unsupportedParamsTransformer struct {
+	params []string
+	logger *zap.Logger
+}
+
+func newUnsupportedParamsTransformer(cfg *config.Config, logger *zap.Logger) (RequestTransformer, error) {
+	return &unsupportedParamsTransformer{params: cfg.Params.Strip, logger: logger}, nil
+}
+
+func (t *unsupportedParamsTransformer) Transform(_ string, body []byte) ([]byte, error) {
+	return transformJSONObject(body, func(data map[string]interface{}) bool {
+		modified := false
+		for _, param := range t.params {
+			if _, exists := data[param]; exists {
+				delete(data, param)
+				t.logger.Info("removed unsupported parameter", zap.String("param", param))
+				modified = true
+			}
+		}
+		return modified
+	})
+}
+
+// rejectParamsTransformer 按 params.reject 规则拒绝请求，不修改请求体
+type rejectParamsTransformer struct {
+	rules []config.ParamRejectRule
+}
+
+func newRejectParamsTransformer(cfg *config.Config, _ *zap.Logger) (RequestTransformer, error) {
+	return &rejectParamsTransformer{rules: cfg.Params.Reject}, nil
+}
+
+func (t *rejectParamsTransformer) Transform(_ string, body []byte) ([]byte, error) {
+	if len(t.rules) == 0 {
+		return body, nil
+	}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body, nil
+	}
+
+	for _, rule := range t.rules {
+		raw, exists := data[rule.Param]
+		if !exists || string(raw) == "null" {
+			continue
+		}
+
+		if rule.Min == nil && rule.Max == nil {
+			return nil, rejectError(rule, fmt.Sprintf("The '%s' parameter is not allowed by this proxy.", rule.Param))
+		}
+
+		// 范围规则只检查数值参数
+		var value float64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			continue
+		}
+		if rule.Min != nil && value < *rule.Min {
+			return nil, rejectError(rule, fmt.Sprintf("The '%s' parameter must be at least %v, got %v.", rule.Param, *rule.Min, value))
+		}
+		if rule.Max != nil && value > *rule.Max {
+			return nil, rejectError(rule, fmt.Sprintf("The '%s' parameter must be at most %v, got %v.", rule.Param, *rule.Max, value))
+		}
+	}
+	return body, nil
+}
+
+func rejectError(rule config.ParamRejectRule, message string) *RequestError {
+	if rule.Message != "" {
+		message = rule.Message
+	}
+	return &RequestError{
+		Param:   rule.Param,
+		Code:    "parameter_not_allowed",
+		Message: message,
+	}
+}
+
+// defaultClampRanges clamp_params 转换器内置的参数范围（与 OpenAI API 文档一致），可由 params.clamp 覆盖或补充
+var defaultClampRanges = map[string][2]float64{
+	"temperature":       {0, 2},
+	"top_p":             {0, 1},
+	"frequency_penalty": {-2, 2},
+	"presence_penalty":  {-2, 2},
+}
+
+// clampParamsTransformer 将超出范围的数值参数截断到边界，避免后端返回难以理解的 400
+type clampParamsTransformer struct {
+	ranges map[string]config.ParamRange
+	logger *zap.Logger
+}
+
+func newClampParamsTransformer(cfg *config.Config, logger *zap.Logger) (RequestTransformer, error) {
+	ranges := make(map[string]config.ParamRange, len(defaultClampRanges)+len(cfg.Params.Clamp))
+	for param, r := range defaultClampRanges {
+		ranges[param] = config.ParamRange{Min: &r[0], Max: &r[1]}
+	}
+	// 配置的范围按边界逐项覆盖，未配置的一侧沿用内置范围
+	for param, r := range cfg.Params.Clamp {
+		merged := ranges[param]
+		if r.Min != nil {
+			merged.Min = r.Min
+		}
+		if r.Max != nil {
+			merged.Max = r.Max
+		}
+		ranges[param] = merged
+	}
+	return &clampParamsTransformer{ranges: ranges, logger: logger}, nil
+}
+
+func (t *clampParamsTransformer) Transform(_ string, body []byte) ([]byte, error) {
+	return transformJSONObject(body, func(data map[string]interface{}) bool {
+		modified := false
+		for param, r := range t.ranges {
+			number, ok := data[param].(json.Number)
+			if !ok {
+				continue
+			}
+			value, err := number.Float64()
+			if err != nil {
+				continue
+			}
+			clamped := value
+			if r.Min != nil && clamped < *r.Min {
+				clamped = *r.Min
+			}
+			if r.Max != nil && clamped > *r.Max {
+				clamped = *r.Max
+			}
+			if clamped == value {
+				continue
+			}
+			data[param] = clamped
+			t.logger.Info("clamped parameter",
+				zap.String("param", param),
+				zap.Float64("value", value),
+				zap.Float64("clamped", clamped),
+			)
+			modified = true
+		}
+		return modified
+	})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/loadbalancer"
+
+	"go.uber.org/zap"
+)
+
+// newTransport 根据 transport 配置构建到后端的 HTTP 传输
+// Azure OpenAI 支持 HTTP/2，多个并发流复用同一连接可避免 HTTP/1.1 的队头阻塞
+// 建立连接与 TLS 握手使用独立的超时，不可达的后端在数秒内失败，不受较长的请求/流式超时影响
+func newTransport(cfg config.TransportConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+
+	protocols := new(http.Protocols)
+	switch cfg.HTTP2 {
+	case "force":
+		protocols.SetHTTP2(true)
+		// 不包含 HTTP1 时，http:// 后端才会使用明文 HTTP/2
+		protocols.SetUnencryptedHTTP2(cfg.H2C)
+	case "disabled":
+		protocols.SetHTTP1(true)
+	default:
+		transport.ForceAttemptHTTP2 = true
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	}
+	transport.Protocols = protocols
+	return transport
+}
+
+// backendClient 返回向该后端发送请求使用的 client：配置了 tls 的后端使用独立的 transport，
+// 超时与 base 相同；未配置时直接返回 base
+func (h *ProxyHandler) backendClient(base *http.Client, backend config.Backend) (*http.Client, error) {
+	if backend.TLS == nil {
+		return base, nil
+	}
+	transport, err := h.tlsTransport(backend)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: base.Timeout, Transport: transport}, nil
+}
+
+// tlsTransport 返回后端 TLS 配置对应的 transport，不存在时创建
+// 相同 TLS 配置的后端共享同一个 transport（连接池）；重载配置新增的 TLS 配置在首次使用时创建
+func (h *ProxyHandler) tlsTransport(backend config.Backend) (*http.Transport, error) {
+	key := fmt.Sprintf("%+v", *backend.TLS)
+
+	h.transportsMu.Lock()
+	defer h.transportsMu.Unlock()
+	if transport, ok := h.tlsTransports[key]; ok {
+		return transport, nil
+	}
+
+	tlsCfg, err := backend.TLS.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("backend tls: %w", err)
+	}
+	if backend.TLS.InsecureSkipVerify {
+		h.logger.Warn("TLS certificate verification is disabled for backend",
+			zap.String("endpoint", loadbalancer.MaskEndpoint(backend.Endpoint)),
+			zap.String("deployment", backend.Deployment),
+		)
+	}
+	transport := newTransport(h.cfg.Transport)
+	transport.TLSClientConfig = tlsCfg
+	h.tlsTransports[key] = transport
+	return transport, nil
+}
+
+// doWithHeaderTimeout 发送请求，timeout 内未收到响应头时取消请求
+// 收到响应头后不再限制（用于流式响应），请求的 context 在响应体关闭时释放
+func doWithHeaderTimeout(client *http.Client, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	resp, err := client.Do(req.WithContext(ctx))
+	timedOut := !timer.Stop()
+	if err != nil {
+		cancel()
+		if timedOut {
+			return nil, fmt.Errorf("timeout awaiting response headers after %s: %w", timeout, err)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose 关闭响应体时同时释放请求的 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"sort"
+)
+
+// maxSSELineSize 流式解析时单行的最大长度，超出部分不做解析（原始数据仍照常转发）
+const maxSSELineSize = 1024 * 1024 // 1MB
+
+// usage 响应中的 token 用量
+// Chat/Embeddings 使用 prompt_tokens/completion_tokens，Responses API 使用 input_tokens/output_tokens
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+
+	// FinishReasons 响应中各个 choice 的 finish_reason，与 token 用量一并记录
+	FinishReasons []string `json:"-"`
+	// ContentFilter 被 Azure 内容过滤标记的类别（去重），不包含内容本身
+	ContentFilter []string `json:"-"`
+}
+
+// normalize 统一字段：将 Responses API 的字段折算到 prompt/completion，并补全 total
+func (u usage) normalize() usage {
+	if u.PromptTokens == 0 {
+		u.PromptTokens = u.InputTokens
+	}
+	if u.CompletionTokens == 0 {
+		u.CompletionTokens = u.OutputTokens
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	return u
+}
+
+// parseUsage 从响应体（或单个 SSE 事件的 data）中解析 usage
+// Responses API 的流式事件把 usage 放在 response 字段内
+func parseUsage(body []byte) (usage, bool) {
+	var resp struct {
+		Usage    *usage `json:"usage"`
+		Response *struct {
+			Usage *usage `json:"usage"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return usage{}, false
+	}
+	u := resp.Usage
+	if u == nil && resp.Response != nil {
+		u = resp.Response.Usage
+	}
+	if u == nil {
+		return usage{}, false
+	}
+	return u.normalize(), true
+}
+
+// finishDetails Responses API 响应的结束状态
+type finishDetails struct {
+	Status            string `json:"status"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+}
+
+// reason Responses API 没有 finish_reason：未完成时使用 incomplete_details.reason（如 max_output_tokens），否则使用 status
+func (d *finishDetails) reason() string {
+	if d == nil {
+		return ""
+	}
+	if d.IncompleteDetails != nil && d.IncompleteDetails.Reason != "" {
+		return d.IncompleteDetails.Reason
+	}
+	return d.Status
+}
+
+// parseFinishReasons 从响应体（或单个 SSE 事件的 data）中解析 finish_reason
+// Chat 响应返回每个 choice 的 finish_reason（流式响应中只有最后一个 chunk 非空）；
+// Responses API 取 response 的结束状态，流式响应中只有 response.completed/incomplete 等结束事件携带
+func parseFinishReasons(body []byte) []string {
+	var resp struct {
+		Choices []struct {
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Object   string         `json:"object"`
+		Response *finishDetails `json:"response"`
+		finishDetails
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+	var reasons []string
+	for _, choice := range resp.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			reasons = append(reasons, *choice.FinishReason)
+		}
+	}
+	switch {
+	case resp.Object == "response":
+		if reason := resp.finishDetails.reason(); reason != "" && reason != "in_progress" {
+			reasons = append(reasons, reason)
+		}
+	case resp.Response != nil:
+		if reason := resp.Response.reason(); reason != "" && reason != "in_progress" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// contentFilterResult Azure 内容过滤单个类别的结果：严重程度类别（hate、violence 等）带 filtered/severity，
+// 检测类别（jailbreak、protected_material_text 等）带 filtered/detected
+type contentFilterResult struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity"`
+	Detected bool   `json:"detected"`
+}
+
+// flagged 类别被过滤、被检测到或严重程度高于 safe 时视为命中
+func (r contentFilterResult) flagged() bool {
+	return r.Filtered || r.Detected || (r.Severity != "" && r.Severity != "safe")
+}
+
+// parseContentFilter 从响应体（或单个 SSE 事件的 data）中解析被内容过滤标记的类别
+// 包括 prompt_filter_results（请求内容）、choices[].content_filter_results（生成内容），
+// 以及请求被拦截时 400 错误中的 error.innererror.content_filter_result
+func parseContentFilter(body []byte) []string {
+	type results map[string]json.RawMessage
+	var resp struct {
+		PromptFilterResults []struct {
+			ContentFilterResults results `json:"content_filter_results"`
+		} `json:"prompt_filter_results"`
+		Choices []struct {
+			ContentFilterResults results `json:"content_filter_results"`
+		} `json:"choices"`
+		Error *struct {
+			InnerError *struct {
+				ContentFilterResult results `json:"content_filter_result"`
+			} `json:"innererror"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+
+	all := make([]results, 0, len(resp.PromptFilterResults)+len(resp.Choices)+1)
+	for _, p := range resp.PromptFilterResults {
+		all = append(all, p.ContentFilterResults)
+	}
+	for _, choice := range resp.Choices {
+		all = append(all, choice.ContentFilterResults)
+	}
+	if resp.Error != nil && resp.Error.InnerError != nil {
+		all = append(all, resp.Error.InnerError.ContentFilterResult)
+	}
+
+	var categories []string
+	for _, r := range all {
+		for category, raw := range r {
+			// custom_blocklists 等类别的结构不同，解析失败时忽略
+			var result contentFilterResult
+			if err := json.Unmarshal(raw, &result); err != nil || !result.flagged() {
+				continue
+			}
+			if !slices.Contains(categories, category) {
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// streamParser 在转发 SSE 流的同时按行解析 data 事件，提取 usage 等信息
+// chat 流式响应只有在客户端设置 stream_options.include_usage 时才会携带 usage
+type streamParser struct {
+	partial  []byte
+	skipping bool // 当前行超长，丢弃直到下一个换行
+
+	usage    usage
+	hasUsage bool
+
+	finishReasons []string
+	contentFilter []string
+}
+
+// feed 输入一段原始流数据
+func (p *streamParser) feed(chunk []byte) {
+	for len(chunk) > 0 {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			p.appendPartial(chunk)
+			return
+		}
+		p.appendPartial(chunk[:i])
+		if !p.skipping {
+			p.handleLine(p.partial)
+		}
+		p.partial = p.partial[:0]
+		p.skipping = false
+		chunk = chunk[i+1:]
+	}
+}
+
+func (p *streamParser) appendPartial(data []byte) {
+	if p.skipping {
+		return
+	}
+	if len(p.partial)+len(data) > maxSSELineSize {
+		p.partial = p.partial[:0]
+		p.skipping = true
+		return
+	}
+	p.partial = append(p.partial, data...)
+}
+
+func (p *streamParser) handleLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+	if bytes.Contains(data, []byte(`"usage"`)) {
+		if u, ok := parseUsage(data); ok {
+			p.usage = u
+			p.hasUsage = true
+		}
+	}
+	// Responses API 的中间事件同样带有 response.status（in_progress），只解析结束事件
+	if bytes.Contains(data, []byte(`"finish_reason"`)) || bytes.Contains(data, []byte(`"status"`)) {
+		p.finishReasons = append(p.finishReasons, parseFinishReasons(data)...)
+	}
+	if bytes.Contains(data, []byte(`filter_result`)) {
+		for _, category := range parseContentFilter(data) {
+			if !slices.Contains(p.contentFilter, category) {
+				p.contentFilter = append(p.contentFilter, category)
+			}
+		}
+	}
+}
+
+// result 返回流中解析到的 usage、finish_reason 与内容过滤命中的类别
+func (p *streamParser) result() (usage, bool) {
+	u := p.usage
+	u.FinishReasons = p.finishReasons
+	sort.Strings(p.contentFilter)
+	u.ContentFilter = p.contentFilter
+	return u, p.hasUsage
+}
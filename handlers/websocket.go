@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// wsCancelledFrame 请求被客户端取消后发送的控制帧
+var wsCancelledFrame = []byte(`{"type":"cancelled"}`)
+
+// wsBusyFrame 上一个请求尚未结束时收到新请求的错误帧
+var wsBusyFrame = []byte(`{"error":{"message":"A request is already in progress on this connection. Send a cancel frame or wait for it to finish.","type":"invalid_request_error","code":"request_in_progress"}}`)
+
+// HandleChatCompletionsWebSocket 通过 WebSocket 提供流式 chat completions
+// 客户端每发送一个请求帧（chat completions 请求体），代理按流式请求转发到后端，
+// 将 SSE 的每个 data 作为一个文本帧返回（以 [DONE] 结束）；请求进行中发送 {"type":"cancel"} 可中止上游请求
+func (h *ProxyHandler) HandleChatCompletionsWebSocket(c *gin.Context) {
+	websocket.Server{
+		// 认证已由中间件在握手请求上完成，不校验 Origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			h.serveWebSocket(c, ws)
+		},
+	}.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveWebSocket 读取客户端帧并调度请求，同一连接同时只处理一个请求
+func (h *ProxyHandler) serveWebSocket(c *gin.Context, ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = maxBodySize
+
+	frames := make(chan []byte)
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		defer close(frames)
+		for {
+			var msg []byte
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+			select {
+			case frames <- msg:
+			case <-closed:
+				return
+			}
+		}
+	}()
+
+	var (
+		cancel context.CancelFunc
+		done   chan struct{} // 为 nil 时表示没有进行中的请求
+	)
+	for {
+		select {
+		case msg, ok := <-frames:
+			if !ok {
+				// 客户端断开，中止进行中的请求
+				if cancel != nil {
+					cancel()
+					<-done
+				}
+				return
+			}
+			if isWebSocketCancel(msg) {
+				if cancel != nil {
+					h.logger.Info("websocket request cancelled by client")
+					cancel()
+				}
+				continue
+			}
+			if done != nil {
+				_, _ = ws.Write(wsBusyFrame)
+				continue
+			}
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(c.Request.Context())
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				h.serveWebSocketRequest(ctx, c, ws, msg)
+			}()
+		case <-done:
+			cancel()
+			cancel, done = nil, nil
+		}
+	}
+}
+
+// isWebSocketCancel 检查是否为 {"type":"cancel"} 控制帧
+func isWebSocketCancel(msg []byte) bool {
+	var frame struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(msg, &frame) == nil && frame.Type == "cancel"
+}
+
+// serveWebSocketRequest 将一个请求帧构造成流式 chat completions 请求，复用常规的处理流程
+func (h *ProxyHandler) serveWebSocketRequest(ctx context.Context, c *gin.Context, ws *websocket.Conn, body []byte) {
+	// 在独立的 goroutine 中处理，不经过 Recovery 中间件
+	defer func() {
+		if r := recover(); r != nil {
+			h.logger.Error("panic recovered in websocket request", zap.Any("error", r), zap.Stack("stack"))
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Request.URL.Path, bytes.NewReader(forceStream(body)))
+	if err != nil {
+		h.logger.Error("failed to build websocket request", zap.Error(err))
+		return
+	}
+	// 沿用握手请求的头部（认证、OpenAI-Organization 等），去掉 WebSocket 握手相关的逐跳头部
+	req.Header = c.Request.Header.Clone()
+	for key := range req.Header {
+		if strings.HasPrefix(key, "Sec-Websocket-") {
+			req.Header.Del(key)
+		}
+	}
+	req.Header.Del("Upgrade")
+	req.Header.Del("Connection")
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	w := &wsResponseWriter{ws: ws, header: make(http.Header), ctx: ctx}
+	inner, _ := gin.CreateTestContext(w)
+	inner.Request = req
+	for key, value := range c.Keys {
+		inner.Set(key, value)
+	}
+
+	h.handleOpenAIRequest(inner, "chat/completions")
+	w.finish()
+
+	if ctx.Err() != nil && c.Request.Context().Err() == nil {
+		_, _ = ws.Write(wsCancelledFrame)
+	}
+}
+
+// forceStream 将请求体中的 stream 设为 true，请求体不是 JSON 对象时原样返回
+func forceStream(body []byte) []byte {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body
+	}
+	data["stream"] = json.RawMessage("true")
+	newBody, err := json.Marshal(data)
+	if err != nil {
+		return body
+	}
+	return newBody
+}
+
+// wsResponseWriter 将处理流程写出的响应转换为 WebSocket 帧
+// SSE 响应按行解析，每个 data 作为一个文本帧发送；其他响应（如错误）在处理结束后整体作为一个帧发送
+type wsResponseWriter struct {
+	ws     *websocket.Conn
+	ctx    context.Context
+	header http.Header
+	status int
+	sse    bool
+	buf    bytes.Buffer
+}
+
+func (w *wsResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *wsResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	w.sse = strings.Contains(w.header.Get("Content-Type"), "text/event-stream")
+}
+
+func (w *wsResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.buf.Write(p)
+	if !w.sse {
+		return len(p), nil
+	}
+
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次写入
+			w.buf.Reset()
+			w.buf.Write(line)
+			return len(p), nil
+		}
+		data, ok := bytes.CutPrefix(bytes.TrimRight(line, "\r\n"), []byte("data:"))
+		if !ok {
+			continue
+		}
+		if _, err := w.ws.Write(bytes.TrimSpace(data)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush 每个 data 行在写入时即已发送
+func (w *wsResponseWriter) Flush() {}
+
+// CloseNotify gin 的 Stream 依赖该接口，请求结束（完成、取消或连接断开）时通知
+func (w *wsResponseWriter) CloseNotify() <-chan bool {
+	ch := make(chan bool, 1)
+	go func() {
+		<-w.ctx.Done()
+		ch <- true
+	}()
+	return ch
+}
+
+// finish 发送缓冲的非 SSE 响应
+func (w *wsResponseWriter) finish() {
+	if !w.sse && w.buf.Len() > 0 {
+		_, _ = w.ws.Write(w.buf.Bytes())
+	}
+}
@@ -1,11 +1,15 @@
 package loadbalancer
 
 import (
+	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"azure-openai-proxy/config"
+
+	"go.uber.org/zap"
 )
 
 type BackendStatus struct {
@@ -13,19 +17,114 @@ type BackendStatus struct {
 	Healthy     bool
 	LastChecked time.Time
 	FailCount   int32
+
+	rpm *tokenBucket // 请求数限流，未配置 max_rpm 时为 nil
+	tpm *tokenBucket // token 数限流，未配置 max_tpm 时为 nil
+
+	notifiedDown bool // 已发送过不健康通知，恢复时据此发送恢复通知
+	probing      bool // 正在进行主动探测，避免同一后端的探测重叠
+
+	probeSuccesses int // 不健康期间连续探测成功的次数，达到 healthy_threshold 才恢复
+
+	// ProbeLatency 最近一次主动探测成功的往返时间，LastProbed 为该次探测的时间，均由 balancer 的 mu 保护
+	ProbeLatency time.Duration
+	LastProbed   time.Time
+
+	load *backendLoad // 进行中请求数与延迟统计，供 least_conn/latency_aware 策略使用
+}
+
+func newBackendStatus(backend config.Backend) *BackendStatus {
+	return &BackendStatus{
+		Backend: backend,
+		Healthy: true,
+		rpm:     newTokenBucket(backend.MaxRPM),
+		tpm:     newTokenBucket(backend.MaxTPM),
+		load:    &backendLoad{},
+	}
+}
+
+// withinBudget 检查后端是否还有 RPM/TPM 余量
+// TPM 在请求前无法得知实际消耗，只要余量为正即可
+func (b *BackendStatus) withinBudget() bool {
+	return b.rpm.available(1) && b.tpm.available(0)
+}
+
+// atConcurrencyLimit 检查后端进行中的请求数是否已达到 max_concurrent
+func (b *BackendStatus) atConcurrencyLimit() bool {
+	return b.Backend.MaxConcurrent > 0 && b.load.active.Load() >= int64(b.Backend.MaxConcurrent)
+}
+
+// MaskedEndpoint 返回遮蔽后的端点地址，用于日志和接口输出
+func (b *BackendStatus) MaskedEndpoint() string {
+	return MaskEndpoint(b.Backend.Endpoint)
+}
+
+// MaskEndpoint 遮蔽端点地址，只保留资源名前 3 个字符
+func MaskEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "***"
+	}
+	resource, rest, _ := strings.Cut(u.Host, ".")
+	if len(resource) > 3 {
+		resource = resource[:3]
+	}
+	masked := u.Scheme + "://" + resource + "***"
+	if rest != "" {
+		masked += "." + rest
+	}
+	return masked
 }
 
 type ModelBalancer struct {
 	backends []*BackendStatus
-	current  uint64
+	source   SelectionSource
+	strategy string // 生效的负载均衡策略
 	mu       sync.RWMutex
+
+	// weighted 策略的平滑加权轮询状态
+	weightMu       sync.Mutex
+	currentWeights map[*BackendStatus]int
+
+	circuitOpenedAt time.Time // 最近一次全部后端变为不健康的时间，由 mu 保护
 }
 
 type LoadBalancer struct {
+	models    map[string]config.ModelConfig // 已配置的模型（包括尚未初始化 balancer 的模型）
 	balancers map[string]*ModelBalancer
+	// modelEnabled 通过管理接口设置的模型启用状态，优先于配置中的 enabled，热加载时清空
+	modelEnabled map[string]bool
+	// catchAll 未配置模型的兜底配置（catch_all），catchAllModels 为据此动态注册的模型
+	catchAll       *config.ModelConfig
+	catchAllModels map[string]bool
+
+	caseInsensitive  bool
+	foldedModels     map[string]string // 小写模型名 -> 配置中的模型名，用于大小写不敏感匹配
+	healthyThreshold int               // 主动探测时恢复所需的连续成功次数
+	passiveHealth    bool              // 为 false 时请求失败不标记后端为不健康
+	strategy         string            // 默认负载均衡策略，模型未配置 strategy 时使用
+	circuitCooldown  time.Duration     // 全部后端不健康后直接拒绝请求的时长，0 表示不启用
+	locality         string            // 本实例所在的区域（locality 策略）
+
+	notifier  HealthNotifier
+	prober    HealthProber
+	newSource func() SelectionSource // 为每个模型 balancer 创建选择来源
+	logger    *zap.Logger
 	mu        sync.RWMutex
+
+	// latencyProber 开启 health_check.latency_probe 时，每个检查周期探测健康的后端以采样延迟
+	latencyProber HealthProber
+
+	// 健康检查循环每完成一轮更新 lastHealthCheck（UnixNano），用于发现检查循环卡死
+	healthCheckInterval time.Duration
+	lastHealthCheck     atomic.Int64
+
+	initialCheckDone atomic.Bool // 启动时对所有后端的主动探测已完成
 }
 
+// healthCheckStaleFactor 健康检查超过该倍数的间隔未完成一轮时视为停滞
+const healthCheckStaleFactor = 3
+
 var (
 	instance *LoadBalancer
 	once     sync.Once
@@ -34,37 +133,249 @@ var (
 // GetInstance 获取负载均衡器单例
 func GetInstance() *LoadBalancer {
 	once.Do(func() {
-		instance = &LoadBalancer{
-			balancers: make(map[string]*ModelBalancer),
-		}
+		instance = newLoadBalancer()
 	})
 	return instance
 }
 
+func newLoadBalancer() *LoadBalancer {
+	return &LoadBalancer{
+		models:       make(map[string]config.ModelConfig),
+		balancers:    make(map[string]*ModelBalancer),
+		foldedModels: make(map[string]string),
+		newSource:    newCounterSource,
+		logger:       zap.NewNop(),
+
+		catchAllModels: make(map[string]bool),
+	}
+}
+
 // Init 初始化负载均衡器
+// 启用 lazy_init 时只记录模型配置，balancer 在模型第一次被请求时才创建
 func (lb *LoadBalancer) Init(cfg *config.Config) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
+	lb.caseInsensitive = cfg.LoadBalancer.CaseInsensitiveModels
+	lb.healthyThreshold = cfg.HealthCheck.HealthyThreshold
+	lb.passiveHealth = cfg.LoadBalancer.PassiveHealth
+	lb.strategy = cfg.LoadBalancer.Strategy
+	lb.circuitCooldown = cfg.LoadBalancer.CircuitCooldown
+	lb.locality = cfg.LoadBalancer.Locality
+	lb.catchAll = cfg.CatchAll
 	for model, modelCfg := range cfg.Models {
-		balancer := &ModelBalancer{
-			backends: make([]*BackendStatus, len(modelCfg.Backends)),
+		lb.models[model] = modelCfg
+		lb.foldedModels[strings.ToLower(model)] = model
+		if !cfg.LoadBalancer.LazyInit {
+			lb.balancers[model] = newModelBalancer(modelCfg, lb.newSource(), modelStrategy(modelCfg, lb.strategy))
 		}
-		for i, backend := range modelCfg.Backends {
-			balancer.backends[i] = &BackendStatus{
-				Backend: backend,
-				Healthy: true,
+	}
+}
+
+// backendKey 后端的身份标识，热加载时据此匹配新旧后端
+func backendKey(backend config.Backend) string {
+	return strings.TrimSuffix(backend.Endpoint, "/") + "|" + backend.Deployment
+}
+
+// Reload 按新配置重建模型与后端
+// 按 endpoint+deployment 匹配已有后端，沿用其健康状态、失败次数和限流令牌，
+// 模型的轮询计数器同样保留；只有新增的后端从初始状态开始，避免每次热加载都打乱流量分布
+func (lb *LoadBalancer) Reload(cfg *config.Config) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	models := make(map[string]config.ModelConfig, len(cfg.Models))
+	balancers := make(map[string]*ModelBalancer, len(cfg.Models))
+	foldedModels := make(map[string]string, len(cfg.Models))
+
+	for model, modelCfg := range cfg.Models {
+		models[model] = modelCfg
+		foldedModels[strings.ToLower(model)] = model
+
+		old, initialized := lb.balancers[model]
+		if !initialized {
+			if !cfg.LoadBalancer.LazyInit {
+				balancers[model] = newModelBalancer(modelCfg, lb.newSource(), modelStrategy(modelCfg, cfg.LoadBalancer.Strategy))
 			}
+			continue
 		}
-		lb.balancers[model] = balancer
+		balancers[model] = reloadModelBalancer(old, modelCfg, modelStrategy(modelCfg, cfg.LoadBalancer.Strategy))
 	}
+
+	// 仍未在配置中出现的 catch_all 模型按新的 catch_all 配置保留，沿用已有后端的状态
+	catchAllModels := make(map[string]bool, len(lb.catchAllModels))
+	if cfg.CatchAll != nil {
+		for model := range lb.catchAllModels {
+			if _, configured := models[model]; configured {
+				continue
+			}
+			modelCfg := catchAllModelConfig(*cfg.CatchAll, model)
+			models[model] = modelCfg
+			foldedModels[strings.ToLower(model)] = model
+			catchAllModels[model] = true
+			if old, initialized := lb.balancers[model]; initialized {
+				balancers[model] = reloadModelBalancer(old, modelCfg, modelStrategy(modelCfg, cfg.LoadBalancer.Strategy))
+			}
+		}
+	}
+
+	lb.models = models
+	lb.balancers = balancers
+	lb.foldedModels = foldedModels
+	lb.catchAll = cfg.CatchAll
+	lb.catchAllModels = catchAllModels
+	lb.modelEnabled = nil
+	lb.caseInsensitive = cfg.LoadBalancer.CaseInsensitiveModels
+	lb.healthyThreshold = cfg.HealthCheck.HealthyThreshold
+	lb.passiveHealth = cfg.LoadBalancer.PassiveHealth
+	lb.strategy = cfg.LoadBalancer.Strategy
+	lb.circuitCooldown = cfg.LoadBalancer.CircuitCooldown
+	lb.locality = cfg.LoadBalancer.Locality
 }
 
-// GetNext 获取下一个可用后端（轮询）
-func (lb *LoadBalancer) GetNext(model string) *BackendStatus {
+// reloadModelBalancer 基于旧 balancer 的状态创建新 balancer
+func reloadModelBalancer(old *ModelBalancer, modelCfg config.ModelConfig, strategy string) *ModelBalancer {
+	old.mu.RLock()
+	defer old.mu.RUnlock()
+
+	existing := make(map[string]*BackendStatus, len(old.backends))
+	for _, b := range old.backends {
+		existing[backendKey(b.Backend)] = b
+	}
+
+	balancer := &ModelBalancer{
+		backends: make([]*BackendStatus, len(modelCfg.Backends)),
+		source:   old.source,
+		strategy: strategy,
+
+		circuitOpenedAt: old.circuitOpenedAt,
+	}
+	for i, backend := range modelCfg.Backends {
+		status := newBackendStatus(backend)
+		if prev, ok := existing[backendKey(backend)]; ok {
+			status.Healthy = prev.Healthy
+			status.LastChecked = prev.LastChecked
+			status.FailCount = prev.FailCount
+			status.probeSuccesses = prev.probeSuccesses
+			status.notifiedDown = prev.notifiedDown
+			status.load = prev.load
+			// 配额未变化时沿用令牌桶，避免热加载后配额被重置
+			if backend.MaxRPM == prev.Backend.MaxRPM {
+				status.rpm = prev.rpm
+			}
+			if backend.MaxTPM == prev.Backend.MaxTPM {
+				status.tpm = prev.tpm
+			}
+		}
+		balancer.backends[i] = status
+	}
+	return balancer
+}
+
+// ModelConfigs 返回当前生效的模型配置
+func (lb *LoadBalancer) ModelConfigs() map[string]config.ModelConfig {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	result := make(map[string]config.ModelConfig, len(lb.models))
+	for model, modelCfg := range lb.models {
+		result[model] = modelCfg
+	}
+	return result
+}
+
+// ModelConfig 返回单个模型的配置
+func (lb *LoadBalancer) ModelConfig(model string) (config.ModelConfig, bool) {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	modelCfg, ok := lb.models[model]
+	return modelCfg, ok
+}
+
+// ConfiguredBackends 返回模型配置的后端数量（不考虑健康状态和限流）
+func (lb *LoadBalancer) ConfiguredBackends(model string) int {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return len(lb.models[model].Backends)
+}
+
+func newModelBalancer(modelCfg config.ModelConfig, source SelectionSource, strategy string) *ModelBalancer {
+	balancer := &ModelBalancer{
+		backends: make([]*BackendStatus, len(modelCfg.Backends)),
+		source:   source,
+		strategy: strategy,
+	}
+	for i, backend := range modelCfg.Backends {
+		balancer.backends[i] = newBackendStatus(backend)
+	}
+	return balancer
+}
+
+// SetNotifier 设置健康状态变化通知器
+func (lb *LoadBalancer) SetNotifier(notifier HealthNotifier) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.notifier = notifier
+}
+
+// SetLogger 设置日志，用于以 debug 级别记录后端选择的决策过程
+func (lb *LoadBalancer) SetLogger(logger *zap.Logger) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.logger = logger
+}
+
+// SetProber 设置主动健康探测器，设置后不健康的后端需探测成功才会恢复
+func (lb *LoadBalancer) SetProber(prober HealthProber) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.prober = prober
+}
+
+// SetLatencyProber 设置延迟采样使用的探测器，设置后每个检查周期探测健康的后端并记录往返时间，不影响健康状态
+func (lb *LoadBalancer) SetLatencyProber(prober HealthProber) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.latencyProber = prober
+}
+
+// notify 发送健康状态变化事件，未配置通知器时忽略
+func (lb *LoadBalancer) notify(event HealthEvent) {
+	lb.mu.RLock()
+	notifier := lb.notifier
+	lb.mu.RUnlock()
+	if notifier != nil {
+		notifier.Notify(event)
+	}
+}
+
+// getBalancer 获取模型的 balancer，尚未初始化时按配置创建
+func (lb *LoadBalancer) getBalancer(model string) (*ModelBalancer, bool) {
 	lb.mu.RLock()
 	balancer, ok := lb.balancers[model]
 	lb.mu.RUnlock()
+	if ok {
+		return balancer, true
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	// 双重检查，避免并发请求重复创建
+	if balancer, ok := lb.balancers[model]; ok {
+		return balancer, true
+	}
+	modelCfg, ok := lb.models[model]
+	if !ok {
+		return nil, false
+	}
+	balancer = newModelBalancer(modelCfg, lb.newSource(), modelStrategy(modelCfg, lb.strategy))
+	lb.balancers[model] = balancer
+	return balancer, true
+}
+
+// GetNext 获取下一个可用后端（轮询）
+func (lb *LoadBalancer) GetNext(model string) *BackendStatus {
+	balancer, ok := lb.getBalancer(model)
 
 	if !ok || len(balancer.backends) == 0 {
 		return nil
@@ -73,14 +384,14 @@ func (lb *LoadBalancer) GetNext(model string) *BackendStatus {
 	// 轮询选择
 	n := len(balancer.backends)
 	for i := 0; i < n; i++ {
-		idx := atomic.AddUint64(&balancer.current, 1) % uint64(n)
+		idx := balancer.source.Next(n)
 		backend := balancer.backends[idx]
 
 		balancer.mu.RLock()
 		healthy := backend.Healthy
 		balancer.mu.RUnlock()
 
-		if healthy {
+		if healthy && backend.withinBudget() && !backend.atConcurrencyLimit() {
 			return backend
 		}
 	}
@@ -91,72 +402,238 @@ func (lb *LoadBalancer) GetNext(model string) *BackendStatus {
 
 // GetAllBackends 获取模型的所有后端（用于故障转移）
 func (lb *LoadBalancer) GetAllBackends(model string) []*BackendStatus {
-	lb.mu.RLock()
-	balancer, ok := lb.balancers[model]
-	lb.mu.RUnlock()
+	return lb.GetBackendsFor(model, "")
+}
+
+// GetBackendsFor 按模型的负载均衡策略返回后端的故障转移顺序，hashKey 供 hash 策略使用
+func (lb *LoadBalancer) GetBackendsFor(model, hashKey string) []*BackendStatus {
+	return lb.GetBackendsMatching(model, hashKey, nil)
+}
+
+// BackendFilter 选择前过滤后端：返回空字符串表示可选，否则返回排除原因（如 not_pinned、tier、tag），记录在 backend selection 日志中
+type BackendFilter func(config.Backend) string
+
+// 后端因配额或并发上限未参与本次选择的原因
+const (
+	SkipOverBudget    = "over_budget"
+	SkipAtConcurrency = "at_concurrency_limit"
+)
+
+// GetBackendsMatching 与 GetBackendsFor 相同，但只在 filter 接受的后端之间选择（filter 为 nil 时不过滤）
+// 先过滤再轮询，避免在全部后端上轮询后再过滤导致流量集中到过滤结果中的第一个后端
+func (lb *LoadBalancer) GetBackendsMatching(model, hashKey string, filter BackendFilter) []*BackendStatus {
+	balancer, ok := lb.getBalancer(model)
 
 	if !ok {
 		return nil
 	}
 
 	// 返回从当前位置开始的后端列表（用于故障转移顺序）
-	n := len(balancer.backends)
-	if n == 0 {
+	if len(balancer.backends) == 0 {
 		return nil
 	}
 
-	result := make([]*BackendStatus, n)
-	// 使用 AddUint64 递增计数器，确保每次请求轮询到不同后端
-	startIdx := atomic.AddUint64(&balancer.current, 1) % uint64(n)
+	// 超出 RPM/TPM 配额的后端在令牌补充前、达到 max_concurrent 的后端在有请求结束前不参与选择；
+	// 只在健康后端之间轮询，不健康的后端排在最后作为兜底。若在全部后端上轮询，
+	// 轮到不健康后端的请求都会故障转移到其后的同一个健康后端，使其承担双倍流量
+	healthy, unhealthy, skipped := balancer.candidates(filter)
+
+	result := make([]*BackendStatus, 0, len(healthy)+len(unhealthy))
+	// 由选择来源决定起始位置，默认递增计数器，确保每次请求轮询到不同后端；
+	// 其他策略在此基础上重新排序，相同条件的后端仍按轮询顺序排列
+	startIdx := 0
+	if len(healthy) > 0 {
+		startIdx = balancer.source.Next(len(healthy))
+		result = append(result, balancer.order(healthy, startIdx, hashKey)...)
+	}
+	// 不健康的后端只作兜底，按配置顺序轮换，不参与策略状态（如加权轮询的当前权重）
+	for i := range unhealthy {
+		result = append(result, unhealthy[(startIdx+i)%len(unhealthy)])
+	}
+	if balancer.strategy == config.StrategyLocality {
+		lb.preferLocal(model, balancer, result, len(healthy), filter)
+	}
 
-	for i := 0; i < n; i++ {
-		idx := (int(startIdx) + i) % n
-		result[i] = balancer.backends[idx]
+	lb.logSelection(model, balancer, startIdx, hashKey, result, skipped)
+	return result
+}
+
+// candidates 按配置顺序返回 filter 接受、配额内且未达到并发上限的健康与不健康后端，以及其余后端未参与选择的原因
+func (mb *ModelBalancer) candidates(filter BackendFilter) (healthy, unhealthy []*BackendStatus, skipped map[*BackendStatus]string) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	skip := func(backend *BackendStatus, reason string) {
+		if skipped == nil {
+			skipped = make(map[*BackendStatus]string)
+		}
+		skipped[backend] = reason
+	}
+	for _, backend := range mb.backends {
+		if filter != nil {
+			if reason := filter(backend.Backend); reason != "" {
+				skip(backend, reason)
+				continue
+			}
+		}
+		if !backend.withinBudget() {
+			skip(backend, SkipOverBudget)
+			continue
+		}
+		if backend.atConcurrencyLimit() {
+			skip(backend, SkipAtConcurrency)
+			continue
+		}
+		if backend.Healthy {
+			healthy = append(healthy, backend)
+		} else {
+			unhealthy = append(unhealthy, backend)
+		}
 	}
+	return healthy, unhealthy, skipped
+}
+
+// AcquireRequest 为即将发往后端的请求扣减一次 RPM 配额，配额不足时返回 false
+func (lb *LoadBalancer) AcquireRequest(backend *BackendStatus) bool {
+	return backend.rpm.tryTake(1)
+}
+
+// ConcurrencyLimited 检查模型是否有后端达到了 max_concurrent，用于区分没有可选后端的原因
+func (lb *LoadBalancer) ConcurrencyLimited(model string) bool {
+	balancer, ok := lb.getBalancer(model)
+	if !ok {
+		return false
+	}
+	balancer.mu.RLock()
+	defer balancer.mu.RUnlock()
+	for _, backend := range balancer.backends {
+		if backend.atConcurrencyLimit() {
+			return true
+		}
+	}
+	return false
+}
 
+// RecordUsage 按响应中解析出的实际 token 用量扣减 TPM 配额
+func (lb *LoadBalancer) RecordUsage(backend *BackendStatus, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	backend.tpm.take(float64(tokens))
+}
+
+// AllBackends 获取所有已初始化模型的后端列表（按配置顺序）
+func (lb *LoadBalancer) AllBackends() map[string][]*BackendStatus {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	result := make(map[string][]*BackendStatus, len(lb.balancers))
+	for model, balancer := range lb.balancers {
+		result[model] = append([]*BackendStatus(nil), balancer.backends...)
+	}
 	return result
 }
 
-// MarkUnhealthy 标记后端为不健康
-func (lb *LoadBalancer) MarkUnhealthy(model string, backend *BackendStatus) {
+// PassiveHealth 返回请求失败时是否标记后端为不健康（loadbalancer.passive_health）
+func (lb *LoadBalancer) PassiveHealth() bool {
 	lb.mu.RLock()
-	balancer, ok := lb.balancers[model]
-	lb.mu.RUnlock()
+	defer lb.mu.RUnlock()
+	return lb.passiveHealth
+}
+
+// MarkUnhealthy 标记后端为不健康，关闭 passive_health 时不做任何处理
+func (lb *LoadBalancer) MarkUnhealthy(model string, backend *BackendStatus) {
+	if !lb.PassiveHealth() {
+		return
+	}
+
+	balancer, ok := lb.getBalancer(model)
 
 	if !ok {
 		return
 	}
+	lb.markDown(model, balancer, backend)
+}
 
+// markDown 将后端标记为不健康，首次下线时发送通知
+func (lb *LoadBalancer) markDown(model string, balancer *ModelBalancer, backend *BackendStatus) {
 	balancer.mu.Lock()
-	defer balancer.mu.Unlock()
-
 	backend.Healthy = false
 	backend.LastChecked = time.Now()
 	backend.FailCount++
+	backend.probeSuccesses = 0
+
+	var event *HealthEvent
+	if !backend.notifiedDown {
+		backend.notifiedDown = true
+		e := newHealthEvent(HealthEventUnhealthy, model, backend)
+		event = &e
+	}
+	allDown := balancer.allUnhealthyLocked()
+	if allDown {
+		balancer.circuitOpenedAt = backend.LastChecked
+	}
+	balancer.mu.Unlock()
+
+	if allDown {
+		lb.mu.RLock()
+		logger, cooldown := lb.logger, lb.circuitCooldown
+		lb.mu.RUnlock()
+		if cooldown > 0 {
+			logger.Warn("all backends unhealthy, opening model circuit",
+				zap.String("model", model),
+				zap.Duration("cooldown", cooldown),
+			)
+		}
+	}
+	if event != nil {
+		lb.notify(*event)
+	}
 }
 
 // MarkHealthy 标记后端为健康
 func (lb *LoadBalancer) MarkHealthy(model string, backend *BackendStatus) {
-	lb.mu.RLock()
-	balancer, ok := lb.balancers[model]
-	lb.mu.RUnlock()
+	balancer, ok := lb.getBalancer(model)
 
 	if !ok {
 		return
 	}
 
 	balancer.mu.Lock()
-	defer balancer.mu.Unlock()
+	var event *HealthEvent
+	if backend.notifiedDown {
+		backend.notifiedDown = false
+		e := newHealthEvent(HealthEventRecovered, model, backend)
+		event = &e
+	}
 
 	backend.Healthy = true
 	backend.LastChecked = time.Now()
 	backend.FailCount = 0
+	backend.probeSuccesses = 0
+	balancer.mu.Unlock()
+
+	if event != nil {
+		lb.notify(*event)
+	}
 }
 
 const defaultRecoveryTimeout = 30 * time.Second
 
+// HealthProber 主动健康探测器
+type HealthProber interface {
+	// Probe 探测后端是否可用，返回 nil 表示可用，latency 为成功的那次探测的往返时间；实现方自行处理超时与重试
+	Probe(backend config.Backend) (latency time.Duration, err error)
+}
+
 // StartHealthCheck 启动健康检查（定期恢复不健康的后端）
+// 未设置探测器时超时后直接恢复；设置了探测器时先主动探测，连续成功 healthy_threshold 次才恢复，
+// 首次探测成功后的后续探测在每个检查周期进行，不再等待恢复超时
 func (lb *LoadBalancer) StartHealthCheck(interval time.Duration) {
+	lb.mu.Lock()
+	lb.healthCheckInterval = interval
+	lb.mu.Unlock()
+	lb.lastHealthCheck.Store(time.Now().UnixNano())
+
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -164,31 +641,134 @@ func (lb *LoadBalancer) StartHealthCheck(interval time.Duration) {
 		for range ticker.C {
 			// 先复制 balancers map，避免长时间持有读锁
 			lb.mu.RLock()
-			balancersCopy := make([]*ModelBalancer, 0, len(lb.balancers))
-			for _, b := range lb.balancers {
-				balancersCopy = append(balancersCopy, b)
+			balancersCopy := make(map[string]*ModelBalancer, len(lb.balancers))
+			for model, b := range lb.balancers {
+				balancersCopy[model] = b
 			}
+			prober := lb.prober
+			latencyProber := lb.latencyProber
+			threshold := lb.healthyThreshold
 			lb.mu.RUnlock()
 
 			// 逐个处理 balancer
-			for _, balancer := range balancersCopy {
+			for model, balancer := range balancersCopy {
 				balancer.mu.Lock()
 				for _, backend := range balancer.backends {
+					if backend.probing {
+						continue
+					}
+					if backend.Healthy {
+						if latencyProber != nil {
+							backend.probing = true
+							go lb.sampleProbeLatency(latencyProber, balancer, backend)
+						}
+						continue
+					}
+					if backend.probeSuccesses == 0 && time.Since(backend.LastChecked) <= defaultRecoveryTimeout {
+						continue
+					}
 					// 超时后自动恢复健康状态以便重试
-					if !backend.Healthy && time.Since(backend.LastChecked) > defaultRecoveryTimeout {
+					if prober == nil {
 						backend.Healthy = true
+						continue
 					}
+					// 探测可能包含多次重试，在锁外并发执行
+					backend.probing = true
+					go lb.probeBackend(prober, model, balancer, backend, threshold)
 				}
 				balancer.mu.Unlock()
 			}
+			lb.lastHealthCheck.Store(time.Now().UnixNano())
 		}
 	}()
 }
 
-// HasModel 检查是否配置了指定模型
+// HealthCheckStatus 返回健康检查最近一轮完成的时间，以及是否已超过 3 倍检查间隔未运行（检查循环卡死或退出）
+// 未启动健康检查时 last 为零值
+func (lb *LoadBalancer) HealthCheckStatus() (last time.Time, stale bool) {
+	lb.mu.RLock()
+	interval := lb.healthCheckInterval
+	lb.mu.RUnlock()
+
+	nanos := lb.lastHealthCheck.Load()
+	if nanos == 0 {
+		return time.Time{}, false
+	}
+	last = time.Unix(0, nanos)
+	return last, time.Since(last) > healthCheckStaleFactor*interval
+}
+
+// probeBackend 探测不健康的后端：连续成功 threshold 次则恢复（发送恢复通知），
+// 失败则清零连续成功次数并重新计时，等待下一个恢复周期
+func (lb *LoadBalancer) probeBackend(prober HealthProber, model string, balancer *ModelBalancer, backend *BackendStatus, threshold int) {
+	latency, err := prober.Probe(backend.Backend)
+
+	balancer.mu.Lock()
+	backend.probing = false
+	recovered := false
+	if err != nil {
+		backend.probeSuccesses = 0
+		backend.LastChecked = time.Now()
+	} else {
+		backend.probeSuccesses++
+		recovered = backend.probeSuccesses >= threshold
+	}
+	balancer.mu.Unlock()
+	if err == nil {
+		lb.recordProbeLatency(balancer, backend, latency)
+	}
+
+	if recovered {
+		lb.MarkHealthy(model, backend)
+	}
+}
+
+// ResolveModel 将请求中的模型名称解析为配置中的模型名称
+// 优先精确匹配；开启 case_insensitive_models 时再忽略大小写匹配
+func (lb *LoadBalancer) ResolveModel(model string) (string, bool) {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	if _, ok := lb.models[model]; ok {
+		return model, true
+	}
+	if lb.caseInsensitive {
+		if resolved, ok := lb.foldedModels[strings.ToLower(model)]; ok {
+			return resolved, true
+		}
+	}
+	return "", false
+}
+
+// ModelEnabled 检查模型是否启用：优先使用管理接口设置的状态，其次是配置中的 enabled
+func (lb *LoadBalancer) ModelEnabled(model string) bool {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	if enabled, ok := lb.modelEnabled[model]; ok {
+		return enabled
+	}
+	return lb.models[model].IsEnabled()
+}
+
+// SetModelEnabled 在运行时启用或禁用模型，不修改配置，下次热加载时恢复为配置中的状态
+// 模型未配置时返回 false
+func (lb *LoadBalancer) SetModelEnabled(model string, enabled bool) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if _, ok := lb.models[model]; !ok {
+		return false
+	}
+	if lb.modelEnabled == nil {
+		lb.modelEnabled = make(map[string]bool)
+	}
+	lb.modelEnabled[model] = enabled
+	return true
+}
+
+// HasModel 检查是否配置了指定模型（以配置为准，不要求 balancer 已初始化）
 func (lb *LoadBalancer) HasModel(model string) bool {
 	lb.mu.RLock()
 	defer lb.mu.RUnlock()
-	_, ok := lb.balancers[model]
+	_, ok := lb.models[model]
 	return ok
 }
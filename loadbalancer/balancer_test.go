@@ -0,0 +1,82 @@
+package loadbalancer
+
+import (
+	"sync"
+	"testing"
+)
+
+// firstPicks 从 goroutines 个 goroutine 并发调用 GetAllBackends，每个调用 perGoroutine 次，按端点统计首选后端
+func firstPicks(lb *LoadBalancer, goroutines, perGoroutine int) map[string]int {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := make(map[string]int)
+			for i := 0; i < perGoroutine; i++ {
+				backends := lb.GetAllBackends("test-model")
+				local[backends[0].Backend.Endpoint]++
+			}
+			mu.Lock()
+			for endpoint, n := range local {
+				counts[endpoint] += n
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return counts
+}
+
+// assertEven 检查 want 中每个后端的首选次数与均值的偏差不超过 tolerance，且其他后端从未被首选
+func assertEven(t *testing.T, counts map[string]int, want []string, total int, tolerance float64) {
+	t.Helper()
+	expected := float64(total) / float64(len(want))
+	seen := 0
+	for _, endpoint := range want {
+		n := counts[endpoint]
+		seen += n
+		if dev := (float64(n) - expected) / expected; dev > tolerance || dev < -tolerance {
+			t.Errorf("%s picked first %d times, expected about %.0f (±%.0f%%)", endpoint, n, expected, tolerance*100)
+		}
+	}
+	if seen != total {
+		t.Errorf("backends outside %v picked first %d times, counts = %v", want, total-seen, counts)
+	}
+}
+
+func TestGetAllBackendsEvenUnderParallelLoad(t *testing.T) {
+	const goroutines, perGoroutine = 32, 300
+	lb := newTestLoadBalancer("", nil, 3)
+
+	counts := firstPicks(lb, goroutines, perGoroutine)
+	backends := lb.AllBackends()["test-model"]
+	assertEven(t, counts, []string{
+		backends[0].Backend.Endpoint,
+		backends[1].Backend.Endpoint,
+		backends[2].Backend.Endpoint,
+	}, goroutines*perGoroutine, 0.05)
+}
+
+func TestGetAllBackendsSkipsUnhealthyUnderParallelLoad(t *testing.T) {
+	const goroutines, perGoroutine = 32, 300
+	lb := newTestLoadBalancer("", nil, 3)
+	backends := lb.AllBackends()["test-model"]
+	lb.MarkUnhealthy("test-model", backends[1])
+
+	// 不健康的后端只作兜底，首选请求在其余两个健康后端之间平均分配，不会集中到不健康后端之后的那一个
+	counts := firstPicks(lb, goroutines, perGoroutine)
+	assertEven(t, counts, []string{
+		backends[0].Backend.Endpoint,
+		backends[2].Backend.Endpoint,
+	}, goroutines*perGoroutine, 0.05)
+
+	for i := 0; i < 10; i++ {
+		order := lb.GetAllBackends("test-model")
+		if last := order[len(order)-1]; last != backends[1] {
+			t.Fatalf("unhealthy backend should be last, got %s", last.Backend.Endpoint)
+		}
+	}
+}
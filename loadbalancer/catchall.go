@@ -0,0 +1,50 @@
+package loadbalancer
+
+import (
+	"regexp"
+	"strings"
+
+	"azure-openai-proxy/config"
+)
+
+// maxCatchAllModels 通过 catch_all 动态注册的模型数上限，避免任意模型名称无限占用内存
+const maxCatchAllModels = 100
+
+// catchAllModelPattern 可交给 catch_all 处理的模型名称，模型名称会成为后端 URL 中的 deployment
+var catchAllModelPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// AddCatchAllModel 为未配置的模型按 catch_all 配置注册模型，deployment 中的 {model} 替换为模型名称
+// 注册后模型与配置中的模型一样拥有独立的 balancer 和健康状态；balancer 在首次使用时创建
+// 未配置 catch_all、模型名称不合法或动态模型数已达上限时返回 false
+func (lb *LoadBalancer) AddCatchAllModel(model string) bool {
+	if !catchAllModelPattern.MatchString(model) {
+		return false
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if lb.catchAll == nil {
+		return false
+	}
+	if _, ok := lb.models[model]; ok {
+		return true
+	}
+	if len(lb.catchAllModels) >= maxCatchAllModels {
+		return false
+	}
+	lb.models[model] = catchAllModelConfig(*lb.catchAll, model)
+	lb.foldedModels[strings.ToLower(model)] = model
+	lb.catchAllModels[model] = true
+	return true
+}
+
+// catchAllModelConfig 返回 catch_all 配置应用到具体模型后的配置
+func catchAllModelConfig(catchAll config.ModelConfig, model string) config.ModelConfig {
+	modelCfg := catchAll
+	modelCfg.Backends = make([]config.Backend, len(catchAll.Backends))
+	for i, backend := range catchAll.Backends {
+		backend.Deployment = strings.ReplaceAll(backend.Deployment, "{model}", model)
+		modelCfg.Backends[i] = backend
+	}
+	return modelCfg
+}
@@ -0,0 +1,48 @@
+package loadbalancer
+
+import "time"
+
+// CircuitCooldown 返回模型熔断的冷却时间（loadbalancer.circuit_cooldown），0 表示不启用
+func (lb *LoadBalancer) CircuitCooldown() time.Duration {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.circuitCooldown
+}
+
+// CircuitOpen 检查模型的熔断是否打开：全部后端都被确认不健康后的冷却时间内直接拒绝新请求，
+// 不再走完整的重试流程；返回剩余的冷却时间
+// 健康检查照常进行，任一后端恢复后熔断立即关闭；冷却时间过后放行请求，再次全部失败时重新打开
+func (lb *LoadBalancer) CircuitOpen(model string) (time.Duration, bool) {
+	cooldown := lb.CircuitCooldown()
+	if cooldown <= 0 {
+		return 0, false
+	}
+	balancer, ok := lb.getBalancer(model)
+	if !ok {
+		return 0, false
+	}
+
+	balancer.mu.RLock()
+	defer balancer.mu.RUnlock()
+	if balancer.circuitOpenedAt.IsZero() || !balancer.allUnhealthyLocked() {
+		return 0, false
+	}
+	remaining := cooldown - time.Since(balancer.circuitOpenedAt)
+	if remaining <= 0 {
+		return 0, false
+	}
+	return remaining, true
+}
+
+// allUnhealthyLocked 检查模型的所有后端是否都不健康，调用方需持有 mu
+func (mb *ModelBalancer) allUnhealthyLocked() bool {
+	if len(mb.backends) == 0 {
+		return false
+	}
+	for _, backend := range mb.backends {
+		if backend.Healthy {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package loadbalancer
+
+import "time"
+
+// BackendHealth 后端健康状态的快照，用于接口输出
+type BackendHealth struct {
+	Endpoint    string     `json:"endpoint"` // 遮蔽后的端点地址
+	Deployment  string     `json:"deployment"`
+	Healthy     bool       `json:"healthy"`
+	FailCount   int32      `json:"fail_count"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	// ProbeLatencyMs 最近一次主动探测成功的往返时间（毫秒），与真实流量无关的基线延迟
+	ProbeLatencyMs *float64   `json:"probe_latency_ms,omitempty"`
+	LastProbed     *time.Time `json:"last_probed,omitempty"`
+}
+
+// BackendHealth 返回模型各后端的健康状态（按配置顺序），模型未配置时返回 false
+// 启用 lazy_init 且模型尚未被请求时，按配置返回健康的后端，不会因此初始化 balancer
+func (lb *LoadBalancer) BackendHealth(model string) ([]BackendHealth, bool) {
+	lb.mu.RLock()
+	modelCfg, ok := lb.models[model]
+	balancer := lb.balancers[model]
+	lb.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	if balancer == nil {
+		result := make([]BackendHealth, 0, len(modelCfg.Backends))
+		for _, backend := range modelCfg.Backends {
+			result = append(result, BackendHealth{
+				Endpoint:   MaskEndpoint(backend.Endpoint),
+				Deployment: backend.Deployment,
+				Healthy:    true,
+			})
+		}
+		return result, true
+	}
+
+	balancer.mu.RLock()
+	defer balancer.mu.RUnlock()
+	result := make([]BackendHealth, 0, len(balancer.backends))
+	for _, backend := range balancer.backends {
+		health := BackendHealth{
+			Endpoint:   backend.MaskedEndpoint(),
+			Deployment: backend.Backend.Deployment,
+			Healthy:    backend.Healthy,
+			FailCount:  backend.FailCount,
+		}
+		if !backend.LastChecked.IsZero() {
+			lastChecked := backend.LastChecked
+			health.LastChecked = &lastChecked
+		}
+		if !backend.LastProbed.IsZero() {
+			latencyMs := float64(backend.ProbeLatency.Microseconds()) / 1000
+			lastProbed := backend.LastProbed
+			health.ProbeLatencyMs = &latencyMs
+			health.LastProbed = &lastProbed
+		}
+		result = append(result, health)
+	}
+	return result, true
+}
@@ -0,0 +1,57 @@
+package loadbalancer
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// preferLocal locality 策略：在健康后端与兜底的不健康后端中，分别将 locality 与本实例相同的后端排在前面（保持轮询顺序）
+// 因此只有本地后端全部不健康、超出配额或达到 max_concurrent 时才首选其他区域的后端，此时记录一条跨区域溢出日志
+func (lb *LoadBalancer) preferLocal(model string, balancer *ModelBalancer, result []*BackendStatus, healthyCount int, filter BackendFilter) {
+	lb.mu.RLock()
+	locality, logger := lb.locality, lb.logger
+	lb.mu.RUnlock()
+
+	isLocal := func(backend *BackendStatus) bool {
+		return backend.Backend.Locality == locality
+	}
+	for _, part := range [][]*BackendStatus{result[:healthyCount], result[healthyCount:]} {
+		sort.SliceStable(part, func(i, j int) bool {
+			return isLocal(part[i]) && !isLocal(part[j])
+		})
+	}
+	if len(result) == 0 || isLocal(result[0]) {
+		return
+	}
+
+	var local, unhealthy, limited int
+	balancer.mu.RLock()
+	for _, backend := range balancer.backends {
+		if !isLocal(backend) || (filter != nil && filter(backend.Backend) != "") {
+			continue
+		}
+		local++
+		switch {
+		case !backend.withinBudget() || backend.atConcurrencyLimit():
+			limited++
+		case !backend.Healthy:
+			unhealthy++
+		}
+	}
+	balancer.mu.RUnlock()
+	// 本次请求可选的后端中没有本地后端时不属于溢出
+	if local == 0 {
+		return
+	}
+
+	logger.Warn("cross-locality spillover",
+		zap.String("model", model),
+		zap.String("locality", locality),
+		zap.String("backend_locality", result[0].Backend.Locality),
+		zap.String("endpoint", result[0].MaskedEndpoint()),
+		zap.Int("local_backends", local),
+		zap.Int("local_unhealthy", unhealthy),
+		zap.Int("local_at_capacity", limited),
+	)
+}
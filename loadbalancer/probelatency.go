@@ -0,0 +1,32 @@
+package loadbalancer
+
+import "time"
+
+// recordProbeLatency 记录主动探测成功的往返时间，作为不依赖真实流量的后端基线延迟
+// 后端还没有真实请求的延迟样本时，同时作为 latency_aware 策略的初始值，之后由真实请求的延迟更新
+// 没有有效往返时间的结果（如探测器未实际发出请求）不记录，避免未探测的后端以 0 延迟排在最前
+func (lb *LoadBalancer) recordProbeLatency(balancer *ModelBalancer, backend *BackendStatus, latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	balancer.mu.Lock()
+	backend.ProbeLatency = latency
+	backend.LastProbed = time.Now()
+	balancer.mu.Unlock()
+
+	backend.load.latency.CompareAndSwap(0, int64(latency))
+}
+
+// sampleProbeLatency 探测健康的后端以采样延迟（health_check.latency_probe）
+// 探测失败只记录日志（由探测器输出），不改变健康状态，后端故障仍由请求失败的被动健康检查处理
+func (lb *LoadBalancer) sampleProbeLatency(prober HealthProber, balancer *ModelBalancer, backend *BackendStatus) {
+	latency, err := prober.Probe(backend.Backend)
+
+	balancer.mu.Lock()
+	backend.probing = false
+	balancer.mu.Unlock()
+
+	if err == nil {
+		lb.recordProbeLatency(balancer, backend, latency)
+	}
+}
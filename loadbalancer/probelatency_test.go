@@ -0,0 +1,47 @@
+package loadbalancer
+
+import (
+	"testing"
+	"time"
+
+	"azure-openai-proxy/config"
+)
+
+// stubProber 返回固定结果的探测器
+type stubProber struct {
+	latency time.Duration
+	err     error
+}
+
+func (p stubProber) Probe(config.Backend) (time.Duration, error) {
+	return p.latency, p.err
+}
+
+func TestSampleProbeLatency(t *testing.T) {
+	tests := []struct {
+		name    string
+		prober  stubProber
+		want    time.Duration
+		wantSet bool
+	}{
+		{"successful probe seeds latency", stubProber{latency: 20 * time.Millisecond}, 20 * time.Millisecond, true},
+		// 探测器未实际探测（如 probe_attempts 为 0）时不能以 0 延迟参与 latency_aware 排序
+		{"zero latency ignored", stubProber{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := newTestLoadBalancer(config.StrategyLatencyAware, nil, 1)
+			balancer, _ := lb.getBalancer("test-model")
+			backend := balancer.backends[0]
+
+			lb.sampleProbeLatency(tt.prober, balancer, backend)
+
+			if got := time.Duration(backend.load.latency.Load()); got != tt.want {
+				t.Errorf("latency EWMA = %v, want %v", got, tt.want)
+			}
+			if backend.LastProbed.IsZero() == tt.wantSet {
+				t.Errorf("LastProbed = %v, want set = %v", backend.LastProbed, tt.wantSet)
+			}
+		})
+	}
+}
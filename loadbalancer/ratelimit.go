@@ -0,0 +1,76 @@
+package loadbalancer
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶，容量为每分钟配额，按秒匀速补充
+// 令牌允许被扣成负数（按实际 token 用量扣减时），此时需等待补充回正后才可再次使用
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 // 每秒补充的令牌数
+	last     time.Time
+}
+
+// newTokenBucket 创建每分钟配额为 perMinute 的令牌桶，perMinute <= 0 时返回 nil 表示不限制
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     time.Now(),
+	}
+}
+
+// refill 按流逝时间补充令牌，调用方需持有锁
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// available 检查桶内是否至少还有 n 个令牌
+func (b *tokenBucket) available(n float64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= n
+}
+
+// tryTake 桶内令牌足够时扣减 n 个并返回 true
+func (b *tokenBucket) tryTake(n float64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// take 无条件扣减 n 个令牌
+func (b *tokenBucket) take(n float64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens -= n
+}
@@ -0,0 +1,108 @@
+package loadbalancer
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunInitialCheck 启动时对所有模型的后端主动探测一次，探测失败的后端标记为不健康，
+// 之后由健康检查循环按正常流程恢复。完成后 InitialCheckDone 返回 true
+// 需要探测全部后端，开启 lazy_init 的模型的 balancer 也会在此时创建
+func (lb *LoadBalancer) RunInitialCheck(prober HealthProber) {
+	lb.mu.RLock()
+	logger := lb.logger
+	lb.mu.RUnlock()
+
+	var (
+		mu     sync.Mutex
+		failed int
+	)
+	total := lb.probeAll(prober, func(model string, balancer *ModelBalancer, backend *BackendStatus, err error) {
+		if err == nil {
+			return
+		}
+		logger.Warn("backend failed initial health check",
+			zap.String("model", model),
+			zap.String("endpoint", backend.MaskedEndpoint()),
+			zap.String("deployment", backend.Backend.Deployment),
+			zap.Error(err),
+		)
+		lb.markDown(model, balancer, backend)
+		mu.Lock()
+		failed++
+		mu.Unlock()
+	})
+
+	lb.initialCheckDone.Store(true)
+	logger.Info("initial health check completed",
+		zap.Int("backends", total),
+		zap.Int("unhealthy", failed),
+	)
+}
+
+// probeAll 并发探测所有模型的全部后端，每个后端的探测结果回调一次 onResult，返回探测的后端数；探测成功时记录往返时间
+// 多个模型共用同一后端（endpoint + deployment）时只探测一次；未初始化的 balancer 会被创建
+func (lb *LoadBalancer) probeAll(prober HealthProber, onResult func(model string, balancer *ModelBalancer, backend *BackendStatus, err error)) int {
+	lb.mu.RLock()
+	models := make([]string, 0, len(lb.models))
+	for model := range lb.models {
+		models = append(models, model)
+	}
+	lb.mu.RUnlock()
+
+	type probeResult struct {
+		done    chan struct{}
+		latency time.Duration
+		err     error
+	}
+	var (
+		mu      sync.Mutex
+		results = make(map[string]*probeResult)
+		wg      sync.WaitGroup
+		total   int
+	)
+	for _, model := range models {
+		balancer, ok := lb.getBalancer(model)
+		if !ok {
+			continue
+		}
+		balancer.mu.RLock()
+		backends := append([]*BackendStatus(nil), balancer.backends...)
+		balancer.mu.RUnlock()
+
+		for _, backend := range backends {
+			total++
+			key := backendKey(backend.Backend)
+			mu.Lock()
+			result, probing := results[key]
+			if !probing {
+				result = &probeResult{done: make(chan struct{})}
+				results[key] = result
+			}
+			mu.Unlock()
+
+			wg.Add(1)
+			go func(model string, balancer *ModelBalancer, backend *BackendStatus) {
+				defer wg.Done()
+				if !probing {
+					result.latency, result.err = prober.Probe(backend.Backend)
+					close(result.done)
+				}
+				<-result.done
+				if result.err == nil {
+					lb.recordProbeLatency(balancer, backend, result.latency)
+				}
+				onResult(model, balancer, backend, result.err)
+			}(model, balancer, backend)
+		}
+	}
+	wg.Wait()
+	return total
+}
+
+// InitialCheckDone 返回启动时的主动探测是否已完成
+func (lb *LoadBalancer) InitialCheckDone() bool {
+	return lb.initialCheckDone.Load()
+}
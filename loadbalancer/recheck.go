@@ -0,0 +1,50 @@
+package loadbalancer
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Recheck 立即主动探测所有模型的全部后端，不等待健康检查周期和恢复超时：
+// 探测成功的不健康后端直接恢复（不要求 healthy_threshold 次连续成功），探测失败的后端标记为不健康
+// 用于已知区域故障恢复后立即恢复流量；返回恢复的后端数与探测失败的后端数
+func (lb *LoadBalancer) Recheck(prober HealthProber) (recovered, failed int) {
+	lb.mu.RLock()
+	logger := lb.logger
+	lb.mu.RUnlock()
+
+	var mu sync.Mutex
+	total := lb.probeAll(prober, func(model string, balancer *ModelBalancer, backend *BackendStatus, err error) {
+		if err != nil {
+			lb.markDown(model, balancer, backend)
+			mu.Lock()
+			failed++
+			mu.Unlock()
+			return
+		}
+
+		balancer.mu.RLock()
+		healthy := backend.Healthy
+		balancer.mu.RUnlock()
+		if healthy {
+			return
+		}
+		logger.Info("backend recovered by recheck",
+			zap.String("model", model),
+			zap.String("endpoint", backend.MaskedEndpoint()),
+			zap.String("deployment", backend.Backend.Deployment),
+		)
+		lb.MarkHealthy(model, backend)
+		mu.Lock()
+		recovered++
+		mu.Unlock()
+	})
+
+	logger.Info("backend recheck completed",
+		zap.Int("backends", total),
+		zap.Int("recovered", recovered),
+		zap.Int("unhealthy", failed),
+	)
+	return recovered, failed
+}
@@ -0,0 +1,160 @@
+package loadbalancer
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"azure-openai-proxy/config"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SelectionSource 决定每次选择后端时从哪个位置开始轮询，以及 random 策略使用的随机数
+// 生产环境使用原子计数器与全局随机数；测试中可注入确定性的实现，精确控制选中的后端
+type SelectionSource interface {
+	// Next 返回 [0, n) 范围内的起始下标
+	Next(n int) int
+	// Intn 返回 [0, n) 范围内的随机数（random 策略）
+	Intn(n int) int
+}
+
+// counterSource 默认实现：原子递增计数器，保证每次请求轮询到不同后端
+type counterSource struct {
+	current uint64
+}
+
+func newCounterSource() SelectionSource {
+	return &counterSource{}
+}
+
+func (s *counterSource) Next(n int) int {
+	return int(atomic.AddUint64(&s.current, 1) % uint64(n))
+}
+
+func (s *counterSource) Intn(n int) int {
+	return rand.IntN(n)
+}
+
+// SetSelectionSource 设置每个模型 balancer 使用的选择来源工厂，传 nil 恢复默认的原子计数器
+// 只影响之后创建的 balancer，应在 Init 之前调用
+func (lb *LoadBalancer) SetSelectionSource(factory func() SelectionSource) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if factory == nil {
+		factory = newCounterSource
+	}
+	lb.newSource = factory
+}
+
+// selectionCandidate 一次后端选择中某个候选后端的决策依据
+type selectionCandidate struct {
+	endpoint      string
+	deployment    string
+	healthy       bool
+	active        int64         // 进行中的请求数（least_conn）
+	weight        int           // 配置的权重（weighted）
+	currentWeight int           // 平滑加权轮询的当前权重（weighted），选择后的值
+	latency       time.Duration // 延迟的指数加权移动平均（latency_aware），0 表示还没有样本
+	hashScore     uint64        // rendezvous hash 分数（hash）
+	strategy      string
+	hashed        bool   // 本次选择使用了 hash key
+	order         int    // 在故障转移顺序中的位置，-1 表示未入选
+	skipped       string // 未入选的原因
+}
+
+func (sc selectionCandidate) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("endpoint", sc.endpoint)
+	enc.AddString("deployment", sc.deployment)
+	enc.AddBool("healthy", sc.healthy)
+	enc.AddInt64("active", sc.active)
+	switch sc.strategy {
+	case config.StrategyWeighted:
+		enc.AddInt("weight", sc.weight)
+		enc.AddInt("current_weight", sc.currentWeight)
+	case config.StrategyLatencyAware:
+		enc.AddFloat64("latency_ms", float64(sc.latency)/float64(time.Millisecond))
+	case config.StrategyHash:
+		if sc.hashed {
+			enc.AddUint64("hash_score", sc.hashScore)
+		}
+	}
+	if sc.order < 0 {
+		enc.AddString("skipped", sc.skipped)
+	} else {
+		enc.AddInt("order", sc.order)
+	}
+	return nil
+}
+
+type selectionCandidates []selectionCandidate
+
+func (cs selectionCandidates) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, sc := range cs {
+		if err := enc.AppendObject(sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logSelection 以 debug 级别记录一次后端选择使用的策略及各候选后端的决策依据（进行中请求数、权重、延迟、hash 分数），便于调优负载均衡
+func (lb *LoadBalancer) logSelection(model string, balancer *ModelBalancer, start int, hashKey string, selected []*BackendStatus, skipped map[*BackendStatus]string) {
+	lb.mu.RLock()
+	logger := lb.logger
+	lb.mu.RUnlock()
+	ce := logger.Check(zapcore.DebugLevel, "backend selection")
+	if ce == nil {
+		return
+	}
+
+	order := make(map[*BackendStatus]int, len(selected))
+	for i, backend := range selected {
+		order[backend] = i
+	}
+
+	strategy := balancer.strategy
+	hashed := strategy == config.StrategyHash && hashKey != ""
+	balancer.mu.RLock()
+	candidates := make(selectionCandidates, len(balancer.backends))
+	for i, backend := range balancer.backends {
+		pos, ok := order[backend]
+		if !ok {
+			pos = -1
+		}
+		candidates[i] = selectionCandidate{
+			endpoint:   backend.MaskedEndpoint(),
+			deployment: backend.Backend.Deployment,
+			healthy:    backend.Healthy,
+			active:     backend.load.active.Load(),
+			weight:     effectiveWeight(backend),
+			latency:    time.Duration(backend.load.latency.Load()),
+			strategy:   strategy,
+			hashed:     hashed,
+			order:      pos,
+			skipped:    skipped[backend],
+		}
+		if hashed {
+			candidates[i].hashScore = hashScore(hashKey, backend)
+		}
+	}
+	balancer.mu.RUnlock()
+	if strategy == config.StrategyWeighted {
+		balancer.weightMu.Lock()
+		for i, backend := range balancer.backends {
+			candidates[i].currentWeight = balancer.currentWeights[backend]
+		}
+		balancer.weightMu.Unlock()
+	}
+
+	fields := []zap.Field{
+		zap.String("model", model),
+		zap.String("strategy", strategy),
+		zap.Int("start_index", start),
+	}
+	if strategy == config.StrategyHash {
+		fields = append(fields, zap.String("hash_key", hashKey))
+	}
+	ce.Write(append(fields, zap.Array("candidates", candidates))...)
+}
@@ -0,0 +1,81 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"testing"
+
+	"azure-openai-proxy/config"
+)
+
+// fixedSource 确定性的选择来源：Next 始终返回 start，Intn 依次返回 picks 中的值
+type fixedSource struct {
+	start int
+	picks []int
+}
+
+func (s *fixedSource) Next(n int) int {
+	return s.start % n
+}
+
+func (s *fixedSource) Intn(n int) int {
+	if len(s.picks) == 0 {
+		return 0
+	}
+	v := s.picks[0]
+	s.picks = s.picks[1:]
+	return v % n
+}
+
+// newTestLoadBalancer 创建只含一个模型（test-model）的负载均衡器，后端依次为 e0、e1……
+func newTestLoadBalancer(strategy string, source func() SelectionSource, n int) *LoadBalancer {
+	backends := make([]config.Backend, n)
+	for i := range backends {
+		backends[i] = config.Backend{
+			Endpoint:   fmt.Sprintf("https://e%d.openai.azure.com", i),
+			Deployment: "gpt-4",
+		}
+	}
+	lb := newLoadBalancer()
+	if source != nil {
+		lb.SetSelectionSource(source)
+	}
+	lb.Init(&config.Config{
+		LoadBalancer: config.LoadBalancerConfig{Strategy: strategy, PassiveHealth: true},
+		Models:       map[string]config.ModelConfig{"test-model": {Backends: backends}},
+	})
+	return lb
+}
+
+// endpointOrder 返回后端列表的端点名称，如 [e1 e2 e0]
+func endpointOrder(backends []*BackendStatus) []string {
+	order := make([]string, len(backends))
+	for i, backend := range backends {
+		order[i] = backend.Backend.Endpoint[len("https://"):len("https://e0")]
+	}
+	return order
+}
+
+func TestSelectionSourceControlsOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		source   *fixedSource
+		want     string
+	}{
+		{"round_robin starts at Next", config.StrategyRoundRobin, &fixedSource{start: 1}, "[e1 e2 e0]"},
+		{"round_robin wraps around", config.StrategyRoundRobin, &fixedSource{start: 5}, "[e2 e0 e1]"},
+		// Fisher-Yates：i=2 与 j=0 交换得 [e2 e1 e0]，i=1 与 j=0 交换得 [e1 e2 e0]
+		{"random shuffles with Intn", config.StrategyRandom, &fixedSource{picks: []int{0, 0}}, "[e1 e2 e0]"},
+		// Intn 返回 i 时不交换，保持原顺序
+		{"random identity", config.StrategyRandom, &fixedSource{picks: []int{2, 1}}, "[e0 e1 e2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := newTestLoadBalancer(tt.strategy, func() SelectionSource { return tt.source }, 3)
+			got := fmt.Sprint(endpointOrder(lb.GetAllBackends("test-model")))
+			if got != tt.want {
+				t.Errorf("order = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package loadbalancer
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"azure-openai-proxy/config"
+)
+
+// latencyEWMAWeight 延迟指数加权移动平均中新样本的权重
+const latencyEWMAWeight = 0.3
+
+// backendLoad 后端的进行中请求数和延迟统计，热加载时沿用
+type backendLoad struct {
+	active  atomic.Int64
+	latency atomic.Int64 // 延迟的指数加权移动平均（纳秒），0 表示还没有样本
+}
+
+// modelStrategy 返回模型生效的负载均衡策略，未配置时使用默认策略
+func modelStrategy(modelCfg config.ModelConfig, defaultStrategy string) string {
+	if modelCfg.Strategy != "" {
+		return modelCfg.Strategy
+	}
+	if defaultStrategy != "" {
+		return defaultStrategy
+	}
+	return config.StrategyRoundRobin
+}
+
+// order 按策略返回候选后端的故障转移顺序，start 为轮询起始位置
+func (mb *ModelBalancer) order(backends []*BackendStatus, start int, hashKey string) []*BackendStatus {
+	n := len(backends)
+	rotated := make([]*BackendStatus, n)
+	for i := 0; i < n; i++ {
+		rotated[i] = backends[(start+i)%n]
+	}
+
+	switch mb.strategy {
+	case config.StrategyWeighted:
+		return mb.weightedOrder(backends)
+	case config.StrategyLeastConn:
+		sort.SliceStable(rotated, func(i, j int) bool {
+			return rotated[i].load.active.Load() < rotated[j].load.active.Load()
+		})
+	case config.StrategyRandom:
+		// Fisher-Yates 洗牌，随机数取自选择来源，测试中可注入确定性实现
+		copy(rotated, backends)
+		for i := n - 1; i > 0; i-- {
+			j := mb.source.Intn(i + 1)
+			rotated[i], rotated[j] = rotated[j], rotated[i]
+		}
+	case config.StrategyHash:
+		// 没有可用的 hash key 时退化为轮询
+		if hashKey != "" {
+			// rendezvous hash：后端增减时只有原本映射到该后端的 key 会改变落点
+			scores := make(map[*BackendStatus]uint64, n)
+			for _, backend := range rotated {
+				scores[backend] = hashScore(hashKey, backend)
+			}
+			sort.SliceStable(rotated, func(i, j int) bool {
+				return scores[rotated[i]] > scores[rotated[j]]
+			})
+		}
+	case config.StrategyLatencyAware:
+		// 还没有延迟样本的后端排在最前，尽快获得样本
+		sort.SliceStable(rotated, func(i, j int) bool {
+			return rotated[i].load.latency.Load() < rotated[j].load.latency.Load()
+		})
+	}
+	return rotated
+}
+
+// hashScore hash 策略中请求标识与后端的 rendezvous hash 分数，分数最高的后端首选
+func hashScore(hashKey string, backend *BackendStatus) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(hashKey + "|" + backendKey(backend.Backend)))
+	return h.Sum64()
+}
+
+// effectiveWeight 后端在 weighted 策略中的权重，未配置或非正数时为 1
+func effectiveWeight(backend *BackendStatus) int {
+	if backend.Backend.Weight <= 0 {
+		return 1
+	}
+	return backend.Backend.Weight
+}
+
+// weightedOrder 平滑加权轮询：在候选后端中选中当前权重最高的后端，其余后端按当前权重从高到低作为故障转移顺序
+func (mb *ModelBalancer) weightedOrder(backends []*BackendStatus) []*BackendStatus {
+	mb.weightMu.Lock()
+	defer mb.weightMu.Unlock()
+
+	if mb.currentWeights == nil {
+		mb.currentWeights = make(map[*BackendStatus]int, len(mb.backends))
+	}
+	total, selected := 0, 0
+	for i, backend := range backends {
+		weight := effectiveWeight(backend)
+		mb.currentWeights[backend] += weight
+		total += weight
+		if mb.currentWeights[backend] > mb.currentWeights[backends[selected]] {
+			selected = i
+		}
+	}
+	mb.currentWeights[backends[selected]] -= total
+
+	result := make([]*BackendStatus, 0, len(backends))
+	result = append(result, backends[selected])
+	for i, backend := range backends {
+		if i != selected {
+			result = append(result, backend)
+		}
+	}
+	rest := result[1:]
+	sort.SliceStable(rest, func(i, j int) bool {
+		return mb.currentWeights[rest[i]] > mb.currentWeights[rest[j]]
+	})
+	return result
+}
+
+// BeginRequest 记录发往后端的进行中请求（least_conn 策略与 max_concurrent），返回的函数在请求结束时调用，多次调用只生效一次
+// 后端已达到 max_concurrent 时不占用并返回 false，选出后端后并发数可能已被其他请求占满
+func (lb *LoadBalancer) BeginRequest(backend *BackendStatus) (func(), bool) {
+	load := backend.load
+	limit := int64(backend.Backend.MaxConcurrent)
+	for {
+		active := load.active.Load()
+		if limit > 0 && active >= limit {
+			return func() {}, false
+		}
+		if load.active.CompareAndSwap(active, active+1) {
+			break
+		}
+	}
+	var done atomic.Bool
+	return func() {
+		if done.CompareAndSwap(false, true) {
+			load.active.Add(-1)
+		}
+	}, true
+}
+
+// RecordLatency 记录一次成功请求的延迟（latency_aware 策略）
+func (lb *LoadBalancer) RecordLatency(backend *BackendStatus, latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	for {
+		old := backend.load.latency.Load()
+		next := int64(latency)
+		if old > 0 {
+			next = int64(latencyEWMAWeight*float64(latency) + (1-latencyEWMAWeight)*float64(old))
+		}
+		if backend.load.latency.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
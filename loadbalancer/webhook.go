@@ -0,0 +1,147 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"azure-openai-proxy/config"
+
+	"go.uber.org/zap"
+)
+
+const (
+	HealthEventUnhealthy = "unhealthy"
+	HealthEventRecovered = "recovered"
+)
+
+// HealthEvent 后端健康状态变化事件
+type HealthEvent struct {
+	Event      string    `json:"event"`
+	Model      string    `json:"model"`
+	Endpoint   string    `json:"endpoint"` // 已遮蔽
+	Deployment string    `json:"deployment"`
+	FailCount  int32     `json:"fail_count"`
+	Timestamp  time.Time `json:"timestamp"`
+	Text       string    `json:"text"` // 可读摘要，兼容 Slack incoming webhook
+}
+
+// HealthNotifier 接收后端健康状态变化事件，Notify 不能阻塞
+type HealthNotifier interface {
+	Notify(event HealthEvent)
+}
+
+const webhookQueueSize = 100
+
+// WebhookNotifier 将健康状态变化事件异步 POST 到 webhook
+// 同一后端的同类事件在 min_interval 内只发送一次，避免后端抖动时刷屏
+type WebhookNotifier struct {
+	cfg    config.WebhookConfig
+	client *http.Client
+	logger *zap.Logger
+	events chan HealthEvent
+
+	lastSent map[string]time.Time
+	mu       sync.Mutex
+}
+
+// NewWebhookNotifier 创建 webhook 通知器并启动发送协程
+func NewWebhookNotifier(cfg config.WebhookConfig, logger *zap.Logger) *WebhookNotifier {
+	n := &WebhookNotifier{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		logger:   logger,
+		events:   make(chan HealthEvent, webhookQueueSize),
+		lastSent: make(map[string]time.Time),
+	}
+	go n.run()
+	return n
+}
+
+// Notify 将事件放入发送队列，被限流或队列已满时丢弃
+func (n *WebhookNotifier) Notify(event HealthEvent) {
+	key := event.Event + "|" + event.Model + "|" + event.Endpoint + "|" + event.Deployment
+
+	n.mu.Lock()
+	if last, ok := n.lastSent[key]; ok && time.Since(last) < n.cfg.MinInterval {
+		n.mu.Unlock()
+		n.logger.Debug("webhook notification rate limited", zap.String("key", key))
+		return
+	}
+	n.lastSent[key] = time.Now()
+	n.mu.Unlock()
+
+	select {
+	case n.events <- event:
+	default:
+		n.logger.Warn("webhook queue full, dropping notification",
+			zap.String("event", event.Event),
+			zap.String("model", event.Model),
+		)
+	}
+}
+
+func (n *WebhookNotifier) run() {
+	for event := range n.events {
+		n.send(event)
+	}
+}
+
+// send 发送单个事件，失败时按指数退避重试，4xx 不重试
+func (n *WebhookNotifier) send(event HealthEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("failed to marshal webhook payload", zap.Error(err))
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 0; attempt <= n.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		resp, err := n.client.Post(n.cfg.URL, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			n.logger.Warn("webhook request failed", zap.Int("attempt", attempt+1), zap.Error(err))
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return
+		}
+		n.logger.Warn("webhook returned error",
+			zap.Int("attempt", attempt+1),
+			zap.Int("status", resp.StatusCode),
+		)
+		if resp.StatusCode < 500 {
+			return
+		}
+	}
+	n.logger.Error("webhook notification dropped after retries",
+		zap.String("event", event.Event),
+		zap.String("model", event.Model),
+	)
+}
+
+// newHealthEvent 构造健康状态变化事件，调用方需持有 balancer 锁
+func newHealthEvent(event, model string, backend *BackendStatus) HealthEvent {
+	e := HealthEvent{
+		Event:      event,
+		Model:      model,
+		Endpoint:   backend.MaskedEndpoint(),
+		Deployment: backend.Backend.Deployment,
+		FailCount:  backend.FailCount,
+		Timestamp:  time.Now(),
+	}
+	e.Text = fmt.Sprintf("[azure-openai-proxy] backend %s (%s, model %s) is %s, fail count %d",
+		e.Endpoint, e.Deployment, e.Model, e.Event, e.FailCount)
+	return e
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"azure-openai-proxy/config"
@@ -17,22 +21,49 @@ import (
 )
 
 func main() {
-	configPath := flag.String("config", "config.yaml", "配置文件路径")
+	configPath := flag.String("config", "config.yaml", "配置文件路径，多个文件或目录以逗号分隔，按顺序合并；支持 http(s)://、consul://、etcd:// 远程配置源")
+	configFallback := flag.String("config-fallback", "", "启动时远程配置源不可达时改用的本地配置")
+	configPollInterval := flag.Duration("config-poll-interval", 30*time.Second, "远程配置源的轮询间隔，变化时热加载，0 表示不轮询")
+	check := flag.Bool("check", false, "只校验配置并输出报告，不启动服务；配置无效时以非 0 状态退出")
+	checkProbe := flag.Bool("check-probe", false, "与 --check 一起使用，对每个后端做一次主动探测，任一后端失败时以非 0 状态退出")
 	flag.Parse()
 
+	if *check {
+		os.Exit(runCheck(*configPath, *checkProbe, os.Stdout))
+	}
+
+	// 加载配置（日志格式由配置决定，因此先于日志初始化）
+	if err := config.Load(*configPath); err != nil {
+		if !errors.Is(err, config.ErrRemoteUnreachable) || *configFallback == "" {
+			log.Fatalf("加载配置失败: %v", err)
+		}
+		log.Printf("远程配置源不可达，改用本地配置 %s: %v", *configFallback, err)
+		if err := config.Load(*configFallback); err != nil {
+			log.Fatalf("加载本地配置失败: %v", err)
+		}
+	}
+
 	// 初始化日志
-	logConfig := zap.NewProductionConfig()
-	logConfig.EncoderConfig.TimeKey = "timestamp"
-	logConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	logger, err := logConfig.Build()
+	logger, err := newLogger(config.AppConfig.Logging)
 	if err != nil {
 		log.Fatalf("初始化日志失败: %v", err)
 	}
 	defer logger.Sync()
 
-	// 加载配置
-	if err := config.Load(*configPath); err != nil {
-		logger.Fatal("加载配置失败", zap.Error(err))
+	auditLogger, err := newAuditLogger(config.AppConfig.Logging, logger)
+	if err != nil {
+		log.Fatalf("初始化审计日志失败: %v", err)
+	}
+	defer auditLogger.Sync()
+
+	// combined 格式的访问日志单独输出，json 格式时请求日志写入主日志
+	requestLogger := logger
+	if config.AppConfig.Logging.AccessLogFormat == "combined" {
+		requestLogger, err = newAccessLogger(config.AppConfig.Logging)
+		if err != nil {
+			log.Fatalf("初始化访问日志失败: %v", err)
+		}
+		defer requestLogger.Sync()
 	}
 
 	// 打印加载的模型列表
@@ -49,29 +80,100 @@ func main() {
 
 	// 初始化负载均衡器
 	lb := loadbalancer.GetInstance()
+	lb.SetLogger(logger)
 	lb.Init(config.AppConfig)
-	lb.StartHealthCheck(10 * time.Second)
+	if config.AppConfig.Webhook.URL != "" {
+		lb.SetNotifier(loadbalancer.NewWebhookNotifier(config.AppConfig.Webhook, logger))
+	}
+	lb.StartHealthCheck(config.AppConfig.HealthCheck.Interval)
 	logger.Info("负载均衡器初始化成功")
 
+	// 收到 SIGHUP 时热加载模型与后端配置
+	go watchReload(*configPath, lb, logger)
+	// 远程配置源变化时同样热加载
+	if config.HasRemoteSource(*configPath) && *configPollInterval > 0 {
+		go pollRemoteConfig(*configPath, *configPollInterval, lb, logger)
+	}
+
 	// 创建处理器
-	proxyHandler := handlers.NewProxyHandler(lb, config.AppConfig, logger)
+	proxyHandler, err := handlers.NewProxyHandler(lb, config.AppConfig, logger)
+	if err != nil {
+		logger.Fatal("创建处理器失败", zap.Error(err))
+	}
+	if config.AppConfig.HealthCheck.Probe {
+		lb.SetProber(proxyHandler)
+	}
+	if config.AppConfig.HealthCheck.LatencyProbe {
+		lb.SetLatencyProber(proxyHandler)
+	}
+	// 开启就绪门控时在后台探测所有后端，完成前 /ready 返回 503
+	if config.AppConfig.HealthCheck.ReadinessGate {
+		go lb.RunInitialCheck(proxyHandler)
+	}
 
 	// 设置 Gin
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.Use(middleware.Logger(logger))
+	// 配置了可信代理时，ClientIP() 只采信来自这些代理的 X-Forwarded-For/X-Real-IP
+	if proxies := config.AppConfig.Server.TrustedProxies; len(proxies) > 0 {
+		if err := router.SetTrustedProxies(proxies); err != nil {
+			logger.Fatal("设置可信代理失败", zap.Error(err))
+		}
+	}
+	router.Use(middleware.Logger(requestLogger, config.AppConfig.Logging))
 	router.Use(middleware.Recovery(logger))
 
+	// 认证使用的 key 存储，未启用认证时为 nil；接入外部 key 存储时在此替换为对应的 KeyStore 实现
+	var keyStore middleware.KeyStore
+	if config.AppConfig.IsAuthEnabled() {
+		keyStore = middleware.NewConfigKeyStore(config.AppConfig)
+	}
+
 	// 路由
 	router.GET("/health", proxyHandler.HandleHealth)
+	router.GET("/ready", proxyHandler.HandleReady)
 
 	// OpenAI 兼容 API 路由 (/v1/...)
 	v1 := router.Group("/v1")
-	v1.Use(middleware.Auth(config.AppConfig, logger))
+	v1.Use(middleware.MaxInFlight(config.AppConfig, logger))
+	v1.Use(middleware.Auth(config.AppConfig, keyStore, logger))
+	v1.Use(middleware.KeyConcurrency(keyStore, logger))
+	v1.Use(middleware.Attribution(config.AppConfig))
 	{
+		v1.GET("/models", proxyHandler.HandleModels)
 		v1.POST("/chat/completions", proxyHandler.HandleChatCompletions)
 		v1.POST("/embeddings", proxyHandler.HandleEmbeddings)
+		v1.POST("/audio/speech", proxyHandler.HandleAudioSpeech)
 		v1.POST("/responses", proxyHandler.HandleResponses)
+		v1.GET("/responses/:id", proxyHandler.HandleResponseResource)
+		v1.DELETE("/responses/:id", proxyHandler.HandleResponseResource)
+		v1.GET("/responses/:id/input_items", proxyHandler.HandleResponseResource)
+		// 旧版 SDK 使用的 engines 路径，引擎名称作为模型，响应附带弃用提示
+		v1.POST("/engines/:engine/completions", proxyHandler.HandleEngine("completions"))
+		v1.POST("/engines/:engine/chat/completions", proxyHandler.HandleEngine("chat/completions"))
+		v1.POST("/engines/:engine/embeddings", proxyHandler.HandleEngine("embeddings"))
+		if config.AppConfig.Server.WebSocket {
+			v1.GET("/chat/completions/ws", proxyHandler.HandleChatCompletionsWebSocket)
+		}
+	}
+
+	// 管理接口路由 (/admin/...)，先按 IP 白名单过滤再认证，只允许管理员 key
+	// 未启用认证时没有管理员 key，只有配置了 ip_allowlist.groups.admin 才注册，否则任何客户端都能调用
+	if config.AppConfig.IsAuthEnabled() || len(config.AppConfig.IPAllowlist.Groups["admin"]) > 0 {
+		admin := router.Group("/admin")
+		admin.Use(middleware.IPAllowlist(config.AppConfig, "admin", logger))
+		admin.Use(middleware.Auth(config.AppConfig, keyStore, logger))
+		admin.Use(middleware.Audit(auditLogger, config.AppConfig.Logging))
+		admin.Use(middleware.AdminOnly(config.AppConfig, logger))
+		{
+			admin.POST("/warmup", proxyHandler.HandleWarmup)
+			admin.GET("/stats", proxyHandler.HandleStats)
+			admin.POST("/backends/recheck", proxyHandler.HandleRecheckBackends)
+			admin.POST("/models/:model/enable", proxyHandler.HandleSetModelEnabled(true))
+			admin.POST("/models/:model/disable", proxyHandler.HandleSetModelEnabled(false))
+		}
+	} else {
+		logger.Warn("未启用认证且未配置 ip_allowlist.groups.admin，不注册管理接口 /admin")
 	}
 
 	// 启动服务
@@ -81,3 +183,140 @@ func main() {
 		logger.Fatal("服务启动失败", zap.Error(err))
 	}
 }
+
+// newLogger 根据日志配置构建 zap logger
+func newLogger(cfg config.LoggingConfig) (*zap.Logger, error) {
+	logConfig, err := loggerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return logConfig.Build()
+}
+
+// loggerConfig 根据 logging 配置构建 zap 配置
+func loggerConfig(cfg config.LoggingConfig) (zap.Config, error) {
+	logConfig := zap.NewProductionConfig()
+	if cfg.Format == "console" {
+		logConfig.Encoding = "console"
+	}
+
+	level, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return logConfig, err
+	}
+	logConfig.Level = zap.NewAtomicLevelAt(level)
+
+	logConfig.EncoderConfig.TimeKey = "timestamp"
+	switch cfg.TimeFormat {
+	case "rfc3339":
+		logConfig.EncoderConfig.EncodeTime = zapcore.RFC3339TimeEncoder
+	case "rfc3339nano":
+		logConfig.EncoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	case "epoch":
+		logConfig.EncoderConfig.EncodeTime = zapcore.EpochTimeEncoder
+	case "epoch_millis":
+		logConfig.EncoderConfig.EncodeTime = zapcore.EpochMillisTimeEncoder
+	default:
+		logConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	}
+
+	// 空 key 表示不输出该字段
+	if cfg.DisableTimestamp {
+		logConfig.EncoderConfig.TimeKey = ""
+	}
+	logConfig.DisableCaller = cfg.DisableCaller
+	logConfig.DisableStacktrace = cfg.DisableStacktrace
+	return logConfig, nil
+}
+
+// newAuditLogger 创建管理操作审计日志：配置了 audit_path 时以 JSON 行追加写入该文件，否则使用主日志
+func newAuditLogger(cfg config.LoggingConfig, logger *zap.Logger) (*zap.Logger, error) {
+	if cfg.AuditPath == "" {
+		return logger.Named("audit"), nil
+	}
+
+	// 审计日志始终以 info 级别、JSON 格式记录，不受 level/format 影响
+	cfg.Level = "info"
+	cfg.Format = "json"
+	logConfig, err := loggerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logConfig.OutputPaths = []string{cfg.AuditPath}
+	return logConfig.Build()
+}
+
+// newAccessLogger 创建 combined 格式访问日志使用的 logger：每条记录一行，只输出消息本身，
+// 写入 access_log_path，为空时输出到标准输出
+func newAccessLogger(cfg config.LoggingConfig) (*zap.Logger, error) {
+	output := "stdout"
+	if cfg.AccessLogPath != "" {
+		output = cfg.AccessLogPath
+	}
+	logConfig := zap.Config{
+		Level:    zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		Encoding: "console",
+		EncoderConfig: zapcore.EncoderConfig{
+			MessageKey: "message",
+			LineEnding: zapcore.DefaultLineEnding,
+		},
+		OutputPaths:      []string{output},
+		ErrorOutputPaths: []string{"stderr"},
+	}
+	return logConfig.Build()
+}
+
+// watchReload 监听 SIGHUP，重新读取配置文件并应用到负载均衡器
+// 目前只有模型与后端配置支持热加载，其他配置修改需要重启生效
+func watchReload(configPath string, lb *loadbalancer.LoadBalancer, logger *zap.Logger) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	for range sighup {
+		reloadConfig(configPath, lb, logger)
+	}
+}
+
+// reloadConfig 重新读取配置并应用到负载均衡器，读取或校验失败时保留当前配置
+// 配置文件编辑到一半（语法错误、读取失败）或校验不通过时不会应用；应用过程中的 panic 也只记录日志，进程不会因热加载退出
+func reloadConfig(configPath string, lb *loadbalancer.LoadBalancer, logger *zap.Logger) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("重新加载配置时发生 panic，继续使用当前配置", zap.Any("panic", r))
+		}
+	}()
+
+	// Read 会完整执行 Validate，通过后才替换负载均衡器的配置
+	cfg, err := config.Read(configPath)
+	if err != nil {
+		logger.Error("重新加载配置失败，继续使用当前配置", zap.Error(err))
+		return
+	}
+	lb.Reload(cfg)
+	logger.Info("配置已重新加载", zap.Int("models_count", len(cfg.Models)))
+}
+
+// pollRemoteConfig 定期读取远程配置源，内容变化时走热加载流程
+// 启动时使用了本地兜底配置的情况下，远程配置源恢复后第一次轮询即会加载
+func pollRemoteConfig(configPath string, interval time.Duration, lb *loadbalancer.LoadBalancer, logger *zap.Logger) {
+	last, err := config.RemoteFingerprint(configPath)
+	if err != nil {
+		logger.Warn("读取远程配置失败", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		fingerprint, err := config.RemoteFingerprint(configPath)
+		if err != nil {
+			logger.Warn("读取远程配置失败，继续使用当前配置", zap.Error(err))
+			continue
+		}
+		if fingerprint == last {
+			continue
+		}
+		logger.Info("远程配置已变化，重新加载")
+		last = fingerprint
+		reloadConfig(configPath, lb, logger)
+	}
+}
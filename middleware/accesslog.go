@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// combinedTimeFormat Combined Log Format 中的时间格式，如 10/Oct/2000:13:55:36 -0700
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// combinedLogLine 按 Combined Log Format 格式化一条访问记录：
+// host ident user [time] "request" status size "referer" "user-agent"
+// user 为 API Key 名称，query 为已遮蔽的 query 字符串，没有对应值的字段输出 -
+func combinedLogLine(c *gin.Context, start time.Time, path, query string, status int) string {
+	user := c.GetString(ContextKeyAPIKeyName)
+	if user == "" {
+		user = "-"
+	}
+	uri := path
+	if query != "" {
+		uri += "?" + query
+	}
+	size := "-"
+	if n := c.Writer.Size(); n > 0 {
+		size = strconv.Itoa(n)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s"`,
+		c.ClientIP(),
+		escapeLogField(user),
+		start.Format(combinedTimeFormat),
+		c.Request.Method,
+		escapeLogField(uri),
+		c.Request.Proto,
+		status,
+		size,
+		escapeLogField(orDash(c.Request.Referer())),
+		escapeLogField(orDash(c.Request.UserAgent())),
+	)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// escapeLogField 与 nginx 相同，将引号、反斜杠和控制字符转义为 \xHH，避免客户端提供的值破坏行格式
+func escapeLogField(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if ch == '"' || ch == '\\' || ch < 0x20 || ch == 0x7f {
+			fmt.Fprintf(&b, `\x%02X`, ch)
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
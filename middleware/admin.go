@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"azure-openai-proxy/config"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AdminOnly 返回管理接口的权限中间件，需放在 Auth 之后：启用认证时只允许管理员 key（auth.keys[].admin），其余 key 返回 403
+// 未启用认证时没有管理员 key，直接放行，此时管理接口只由 ip_allowlist.groups.admin 保护（main.go 仅在配置了该白名单时注册 /admin）
+func AdminOnly(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.IsAuthEnabled() {
+			c.Next()
+			return
+		}
+
+		keyName := c.GetString(ContextKeyAPIKeyName)
+		if !cfg.IsAdminKey(keyName) {
+			logger.Warn("non-admin key denied admin access",
+				zap.String("path", c.Request.URL.Path),
+				zap.String("key_name", keyName),
+				zap.String("ip", c.ClientIP()),
+			)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"message": "This API key is not allowed to access admin endpoints.",
+					"type":    "permission_error",
+					"code":    "admin_required",
+				},
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
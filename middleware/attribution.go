@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"azure-openai-proxy/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKeyAttribution 用于在 context 中存储用量归属（请求头名称 -> 取值）的键
+const ContextKeyAttribution = "usage_attribution"
+
+// Attribution 返回用量归属中间件，将 usage_attribution.headers 配置的请求头存入 context
+// 请求未携带的请求头归入 default_bucket；未配置 headers 时不做任何处理
+func Attribution(cfg *config.Config) gin.HandlerFunc {
+	headers := cfg.Attribution.Headers
+	defaultBucket := cfg.Attribution.DefaultBucket
+
+	return func(c *gin.Context) {
+		if len(headers) == 0 {
+			c.Next()
+			return
+		}
+
+		attribution := make(map[string]string, len(headers))
+		for _, header := range headers {
+			value := strings.TrimSpace(c.GetHeader(header))
+			if value == "" {
+				value = defaultBucket
+			}
+			attribution[http.CanonicalHeaderKey(header)] = value
+		}
+		c.Set(ContextKeyAttribution, attribution)
+		c.Next()
+	}
+}
+
+// GetAttribution 返回请求的用量归属，未配置时为 nil
+func GetAttribution(c *gin.Context) map[string]string {
+	attribution, _ := c.Get(ContextKeyAttribution)
+	m, _ := attribution.(map[string]string)
+	return m
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"azure-openai-proxy/config"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxAuditBodySize 审计日志中记录的请求体上限，超出时只记录大小
+const maxAuditBodySize = 64 * 1024
+
+// Audit 返回管理操作审计中间件，需放在 Auth 之后以获取 key 名称
+// 记录所有修改类（非 GET/HEAD）请求的操作者、来源 IP、操作、参数与结果，query 中的 API Key 按 cfg 遮蔽
+func Audit(logger *zap.Logger, cfg config.LoggingConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		fields := []zap.Field{
+			zap.String("action", c.Request.Method+" "+c.Request.URL.Path),
+			zap.String("key_name", c.GetString(ContextKeyAPIKeyName)),
+			zap.String("ip", c.ClientIP()),
+		}
+		if query := c.Request.URL.Query(); len(query) > 0 {
+			maskQueryValues(query, cfg)
+			fields = append(fields, zap.Any("query", query))
+		}
+		if params, ok := auditBody(c); ok {
+			fields = append(fields, params)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		result := "success"
+		if status >= http.StatusBadRequest {
+			result = "failure"
+		}
+		fields = append(fields,
+			zap.Int("status", status),
+			zap.String("result", result),
+			zap.Duration("latency", time.Since(start)),
+		)
+		logger.Info("admin action", fields...)
+	}
+}
+
+// auditBody 读取请求体作为审计参数并恢复请求体，没有请求体时返回 false
+func auditBody(c *gin.Context) (zap.Field, bool) {
+	if c.Request.Body == nil {
+		return zap.Skip(), false
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAuditBodySize+1))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil || len(body) == 0 {
+		return zap.Skip(), false
+	}
+
+	switch {
+	case len(body) > maxAuditBodySize:
+		return zap.String("params", "body exceeds 64KB, not recorded"), true
+	case json.Valid(body):
+		return zap.Reflect("params", json.RawMessage(body)), true
+	default:
+		return zap.ByteString("params", body), true
+	}
+}
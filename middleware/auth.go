@@ -13,11 +13,17 @@ import (
 // ContextKeyAPIKeyName 用于在 context 中存储 API Key 名称的键
 const ContextKeyAPIKeyName = "api_key_name"
 
-// Auth 返回认证中间件
-func Auth(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+// Auth 返回认证中间件，通过 store 校验 key；store 为 nil 表示未启用认证
+func Auth(cfg *config.Config, store KeyStore, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 如果未启用认证，直接放行
-		if !cfg.IsAuthEnabled() {
+		if store == nil {
+			c.Next()
+			return
+		}
+
+		// 免认证路径（如公开的模型目录）直接放行，用量统计记为 anonymous
+		if cfg.Auth.IsExemptPath(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
@@ -40,10 +46,10 @@ func Auth(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
 		}
 
 		// 验证 API Key
-		keyName, valid := cfg.ValidateAPIKey(apiKey)
+		keyName, valid := store.Validate(apiKey)
 		if !valid {
 			// 日志中只记录 key 的前缀，避免泄露完整 key
-			maskedKey := maskAPIKey(apiKey)
+			maskedKey := cfg.Logging.MaskKey(apiKey)
 			logger.Warn("invalid api key",
 				zap.String("path", c.Request.URL.Path),
 				zap.String("ip", c.ClientIP()),
@@ -91,11 +97,3 @@ func extractAPIKey(c *gin.Context) string {
 
 	return ""
 }
-
-// maskAPIKey 遮蔽 API Key，只显示前 8 个字符
-func maskAPIKey(key string) string {
-	if len(key) <= 8 {
-		return "***"
-	}
-	return key[:8] + "***"
-}
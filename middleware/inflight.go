@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+
+	"azure-openai-proxy/config"
+	"azure-openai-proxy/stats"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MaxInFlight 返回全局并发限制中间件：统计正在处理的请求数，
+// 超出 server.max_in_flight 时直接返回 503 并附带 Retry-After，避免流量高峰耗尽内存和文件描述符
+func MaxInFlight(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	limit := int64(cfg.Server.MaxInFlight)
+	collector := stats.GetInstance()
+
+	return func(c *gin.Context) {
+		n := collector.AddInFlight(1)
+		defer collector.AddInFlight(-1)
+
+		if limit > 0 && n > limit {
+			logger.Warn("too many in-flight requests, shedding load",
+				zap.String("path", c.Request.URL.Path),
+				zap.Int64("in_flight", n-1),
+				zap.Int64("limit", limit),
+			)
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{
+					"message": "The server is currently handling too many requests. Please retry after a short delay.",
+					"type":    "server_error",
+					"code":    "server_overloaded",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"azure-openai-proxy/stats"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// KeyConcurrency 返回按 key 的并发限制中间件，需在 Auth 之后注册：
+// 统计每个 key 正在处理的请求数，超出 store 中该 key 的 MaxConcurrent（auth.keys[].max_concurrent）时
+// 返回 429 并附带 Retry-After，避免单个客户端占满后端；store 为 nil（未启用认证）时不限制
+func KeyConcurrency(store KeyStore, logger *zap.Logger) gin.HandlerFunc {
+	collector := stats.GetInstance()
+
+	return func(c *gin.Context) {
+		keyName := c.GetString(ContextKeyAPIKeyName)
+		if keyName == "" || store == nil {
+			c.Next()
+			return
+		}
+
+		n := collector.AddKeyInFlight(keyName, 1)
+		defer collector.AddKeyInFlight(keyName, -1)
+
+		if limit := int64(store.Limits(keyName).MaxConcurrent); limit > 0 && n > limit {
+			logger.Warn("api key concurrency limit exceeded",
+				zap.String("key", keyName),
+				zap.String("path", c.Request.URL.Path),
+				zap.Int64("in_flight", n-1),
+				zap.Int64("limit", limit),
+			)
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": "Too many concurrent requests for this API key. Please retry after a short delay.",
+					"type":    "rate_limit_error",
+					"code":    "too_many_concurrent_requests",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import "azure-openai-proxy/config"
+
+// KeyStore 客户端 API Key 的存储，Auth 与 KeyConcurrency 中间件通过它校验 key、读取限制
+// 默认实现为配置文件中的 auth.keys（ConfigKeyStore）；在数据库、Redis 等外部存储中管理 key 时，
+// 实现该接口并在 main.go 中替换即可，无需修改认证逻辑
+type KeyStore interface {
+	// Validate 校验客户端提供的 key，有效时返回 key 的名称（用于日志、用量统计与限流）
+	Validate(key string) (name string, ok bool)
+	// Limits 返回该名称的 key 的限制，未知的名称返回零值（不限制）
+	Limits(name string) KeyLimits
+}
+
+// KeyLimits 单个 key 的限制，零值表示不限制
+type KeyLimits struct {
+	MaxConcurrent int // 同时进行中的请求数上限，超出时返回 429
+}
+
+// ConfigKeyStore 基于配置文件 auth.keys 的 KeyStore
+type ConfigKeyStore struct {
+	cfg *config.Config
+}
+
+// NewConfigKeyStore 创建基于配置文件的 KeyStore
+func NewConfigKeyStore(cfg *config.Config) *ConfigKeyStore {
+	return &ConfigKeyStore{cfg: cfg}
+}
+
+// Validate 按 auth.keys 的 key/key_hash 校验
+func (s *ConfigKeyStore) Validate(key string) (string, bool) {
+	return s.cfg.ValidateAPIKey(key)
+}
+
+// Limits 返回 auth.keys 中该 key 的限制
+func (s *ConfigKeyStore) Limits(name string) KeyLimits {
+	return KeyLimits{MaxConcurrent: s.cfg.KeyMaxConcurrent(name)}
+}
@@ -1,24 +1,46 @@
 package middleware
 
 import (
+	"math/rand/v2"
+	"net/http"
 	"time"
 
+	"azure-openai-proxy/config"
+
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-func Logger(logger *zap.Logger) gin.HandlerFunc {
+// ContextKeyStreamTTFB 用于在 context 中存储流式响应首字节时间（time.Duration）的键
+const ContextKeyStreamTTFB = "stream_ttfb"
+
+// Logger 请求日志中间件
+// 非 2xx 响应和超过 slow_request_threshold 的慢请求始终记录，其余请求按 request_sample_rate 采样
+// access_log_format 为 combined 时以 Combined Log Format 输出，logger 只需输出消息本身
+func Logger(logger *zap.Logger, cfg config.LoggingConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
+		// query 中可能携带 API Key（如 ?api-key=...），记录前遮蔽
+		query := maskQueryKeys(c.Request.URL.RawQuery, cfg)
 
 		c.Next()
 
 		latency := time.Since(start)
 		status := c.Writer.Status()
 
-		logger.Info("request",
+		success := status >= http.StatusOK && status < http.StatusMultipleChoices
+		slow := cfg.SlowRequestThreshold > 0 && latency >= cfg.SlowRequestThreshold
+		if success && !slow && cfg.RequestSampleRate < 1 && rand.Float64() >= cfg.RequestSampleRate {
+			return
+		}
+
+		if cfg.AccessLogFormat == "combined" {
+			logger.Info(combinedLogLine(c, start, path, query, status))
+			return
+		}
+
+		fields := []zap.Field{
 			zap.Int("status", status),
 			zap.String("method", c.Request.Method),
 			zap.String("path", path),
@@ -26,7 +48,26 @@ func Logger(logger *zap.Logger) gin.HandlerFunc {
 			zap.String("ip", c.ClientIP()),
 			zap.Duration("latency", latency),
 			zap.Int("size", c.Writer.Size()),
-		)
+		}
+		// OpenAI 组织/项目 header 用于多组织用量归属
+		if org := c.GetHeader("OpenAI-Organization"); org != "" {
+			fields = append(fields, zap.String("openai_organization", org))
+		}
+		if project := c.GetHeader("OpenAI-Project"); project != "" {
+			fields = append(fields, zap.String("openai_project", project))
+		}
+
+		// 流式请求的首字节时间，与总耗时 latency 分开记录
+		if ttfb, ok := c.Get(ContextKeyStreamTTFB); ok {
+			if d, ok := ttfb.(time.Duration); ok {
+				fields = append(fields, zap.Duration("ttfb", d))
+			}
+		}
+		if slow {
+			fields = append(fields, zap.Bool("slow", true))
+		}
+
+		logger.Info("request", fields...)
 	}
 }
 
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+
+	"azure-openai-proxy/config"
+)
+
+// keyQueryParams 可能携带 API Key 的 query 参数（如 Azure SDK 风格的 ?api-key=...），记录日志前遮蔽
+var keyQueryParams = map[string]struct{}{
+	"api-key":          {},
+	"api_key":          {},
+	"x-api-key":        {},
+	"key":              {},
+	"subscription-key": {},
+}
+
+func isKeyQueryParam(name string) bool {
+	_, ok := keyQueryParams[strings.ToLower(name)]
+	return ok
+}
+
+// maskQueryKeys 遮蔽原始 query 字符串中携带 API Key 的参数值，其余参数与顺序保持不变
+func maskQueryKeys(rawQuery string, cfg config.LoggingConfig) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		rawName, rawValue, _ := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil || !isKeyQueryParam(name) {
+			continue
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			value = rawValue
+		}
+		parts[i] = rawName + "=" + cfg.MaskKey(value)
+	}
+	return strings.Join(parts, "&")
+}
+
+// maskQueryValues 遮蔽已解析的 query 中携带 API Key 的参数值（原地修改）
+func maskQueryValues(values url.Values, cfg config.LoggingConfig) {
+	for name, vals := range values {
+		if !isKeyQueryParam(name) {
+			continue
+		}
+		for i, value := range vals {
+			vals[i] = cfg.MaskKey(value)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyStats 单个 API Key 的累计用量
+type KeyStats struct {
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	EstimatedCost    float64 `json:"estimated_cost_usd"`
+}
+
+// LatencyStats 一组延迟样本的汇总（毫秒）
+type LatencyStats struct {
+	Count int64   `json:"count"`
+	AvgMs float64 `json:"avg_ms"`
+	MaxMs float64 `json:"max_ms"`
+	sumMs float64
+}
+
+// Collector 进程内的用量统计
+type Collector struct {
+	startedAt time.Time
+	keys      map[string]*KeyStats
+	// attribution 按用量归属请求头分组的用量：请求头名称 -> 取值 -> 用量
+	attribution map[string]map[string]*KeyStats
+	// finishReasons 按模型统计的 finish_reason 次数：模型 -> finish_reason -> 次数
+	finishReasons map[string]map[string]int64
+	// contentFilterModels/contentFilterKeys 按模型/key 统计的内容过滤命中类别次数：模型或 key -> 类别 -> 次数
+	contentFilterModels map[string]map[string]int64
+	contentFilterKeys   map[string]map[string]int64
+	inFlight            atomic.Int64 // 正在处理的请求数
+	// keyInFlight 按 key 统计的正在处理的请求数
+	keyInFlight map[string]*atomic.Int64
+	// streamTTFB 按模型统计的流式响应首字节时间
+	streamTTFB map[string]*LatencyStats
+	mu         sync.Mutex
+}
+
+var (
+	instance *Collector
+	once     sync.Once
+)
+
+// GetInstance 获取统计收集器单例
+func GetInstance() *Collector {
+	once.Do(func() {
+		instance = &Collector{
+			startedAt:     time.Now(),
+			keys:          make(map[string]*KeyStats),
+			attribution:   make(map[string]map[string]*KeyStats),
+			finishReasons: make(map[string]map[string]int64),
+
+			contentFilterModels: make(map[string]map[string]int64),
+			contentFilterKeys:   make(map[string]map[string]int64),
+			keyInFlight:         make(map[string]*atomic.Int64),
+			streamTTFB:          make(map[string]*LatencyStats),
+		}
+	})
+	return instance
+}
+
+// Record 记录一次成功转发的请求及其用量，同时计入 attribution 中每个请求头取值的分组
+func (c *Collector) Record(keyName string, attribution map[string]string, promptTokens, completionTokens, totalTokens int, cost float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.keys[keyName]
+	if !ok {
+		s = &KeyStats{}
+		c.keys[keyName] = s
+	}
+	s.add(promptTokens, completionTokens, totalTokens, cost)
+
+	for header, value := range attribution {
+		groups, ok := c.attribution[header]
+		if !ok {
+			groups = make(map[string]*KeyStats)
+			c.attribution[header] = groups
+		}
+		g, ok := groups[value]
+		if !ok {
+			g = &KeyStats{}
+			groups[value] = g
+		}
+		g.add(promptTokens, completionTokens, totalTokens, cost)
+	}
+}
+
+func (s *KeyStats) add(promptTokens, completionTokens, totalTokens int, cost float64) {
+	s.Requests++
+	s.PromptTokens += int64(promptTokens)
+	s.CompletionTokens += int64(completionTokens)
+	s.TotalTokens += int64(totalTokens)
+	s.EstimatedCost += cost
+}
+
+// StartedAt 返回统计开始时间（即进程启动时间）
+func (c *Collector) StartedAt() time.Time {
+	return c.startedAt
+}
+
+// Keys 返回按 key 名称汇总的用量快照
+func (c *Collector) Keys() map[string]KeyStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[string]KeyStats, len(c.keys))
+	for name, s := range c.keys {
+		result[name] = *s
+	}
+	return result
+}
+
+// Attribution 返回按用量归属请求头及其取值汇总的用量快照
+func (c *Collector) Attribution() map[string]map[string]KeyStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[string]map[string]KeyStats, len(c.attribution))
+	for header, groups := range c.attribution {
+		snapshot := make(map[string]KeyStats, len(groups))
+		for value, s := range groups {
+			snapshot[value] = *s
+		}
+		result[header] = snapshot
+	}
+	return result
+}
+
+// RecordFinishReasons 记录一次请求中各个 choice 的 finish_reason
+func (c *Collector) RecordFinishReasons(model string, reasons []string) {
+	if len(reasons) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	addCounts(c.finishReasons, model, reasons)
+}
+
+// FinishReasons 返回按模型汇总的 finish_reason 次数快照
+func (c *Collector) FinishReasons() map[string]map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return snapshotCounts(c.finishReasons)
+}
+
+// RecordContentFilter 记录一次请求中被 Azure 内容过滤标记的类别（如 hate、violence、jailbreak）
+func (c *Collector) RecordContentFilter(model, keyName string, categories []string) {
+	if len(categories) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	addCounts(c.contentFilterModels, model, categories)
+	addCounts(c.contentFilterKeys, keyName, categories)
+}
+
+// ContentFilter 返回按模型和按 key 汇总的内容过滤类别命中次数快照
+func (c *Collector) ContentFilter() (models, keys map[string]map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return snapshotCounts(c.contentFilterModels), snapshotCounts(c.contentFilterKeys)
+}
+
+// RecordStreamTTFB 记录一次流式响应的首字节时间（从发送上游请求到读到第一块数据）
+func (c *Collector) RecordStreamTTFB(model string, ttfb time.Duration) {
+	ms := float64(ttfb) / float64(time.Millisecond)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.streamTTFB[model]
+	if !ok {
+		s = &LatencyStats{}
+		c.streamTTFB[model] = s
+	}
+	s.Count++
+	s.sumMs += ms
+	s.AvgMs = s.sumMs / float64(s.Count)
+	s.MaxMs = max(s.MaxMs, ms)
+}
+
+// StreamTTFB 返回按模型汇总的流式响应首字节时间快照
+func (c *Collector) StreamTTFB() map[string]LatencyStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make(map[string]LatencyStats, len(c.streamTTFB))
+	for model, s := range c.streamTTFB {
+		result[model] = *s
+	}
+	return result
+}
+
+// addCounts 为 group 下的每个值计数一次，调用方需持有 mu
+func addCounts(m map[string]map[string]int64, group string, values []string) {
+	counts, ok := m[group]
+	if !ok {
+		counts = make(map[string]int64)
+		m[group] = counts
+	}
+	for _, value := range values {
+		counts[value]++
+	}
+}
+
+// snapshotCounts 复制两级计数 map，调用方需持有 mu
+func snapshotCounts(m map[string]map[string]int64) map[string]map[string]int64 {
+	result := make(map[string]map[string]int64, len(m))
+	for group, counts := range m {
+		snapshot := make(map[string]int64, len(counts))
+		for value, n := range counts {
+			snapshot[value] = n
+		}
+		result[group] = snapshot
+	}
+	return result
+}
+
+// AddInFlight 调整正在处理的请求数，返回调整后的值
+func (c *Collector) AddInFlight(delta int64) int64 {
+	return c.inFlight.Add(delta)
+}
+
+// InFlight 返回正在处理的请求数
+func (c *Collector) InFlight() int64 {
+	return c.inFlight.Load()
+}
+
+// AddKeyInFlight 调整 key 正在处理的请求数，返回调整后的值
+func (c *Collector) AddKeyInFlight(keyName string, delta int64) int64 {
+	c.mu.Lock()
+	counter, ok := c.keyInFlight[keyName]
+	if !ok {
+		counter = &atomic.Int64{}
+		c.keyInFlight[keyName] = counter
+	}
+	c.mu.Unlock()
+	return counter.Add(delta)
+}
+
+// KeyInFlight 返回按 key 统计的正在处理的请求数
+func (c *Collector) KeyInFlight() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[string]int64, len(c.keyInFlight))
+	for keyName, counter := range c.keyInFlight {
+		result[keyName] = counter.Load()
+	}
+	return result
+}